@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/chainbound/fiber-benchmarks/health"
 	"github.com/chainbound/fiber-benchmarks/log"
 	"github.com/chainbound/fiber-benchmarks/sinks"
-	"github.com/chainbound/fiber-benchmarks/sources/bloxroute"
+	"github.com/chainbound/fiber-benchmarks/sources"
 	"github.com/chainbound/fiber-benchmarks/sources/fiber"
 	"github.com/chainbound/fiber-benchmarks/types"
 	"github.com/ethereum/go-ethereum/common"
@@ -19,36 +22,55 @@ type BlockBenchmarker struct {
 	logger zerolog.Logger
 
 	fiberSource     *fiber.FiberSource
-	otherSource     BlockSource
+	other           *otherStream[types.BlockObservation]
 	otherSourceName string
 
-	sink Sink
+	sink sinks.Sink
 }
 
-func runBlockBenchmark(config *config) error {
+func runBlockBenchmark(ctx context.Context, config *config) error {
 	// - For each interval, we collect all data from both streams
 	// - At the end of the interval, we print the stats and save the result
 	// - At the end of the benchmark, we print the overall stats
 	logger := log.NewLogger("benchmark")
 
 	if err := config.validate(); err != nil {
-		logger.Fatal().Err(err).Msg("Invalid config")
+		return fmt.Errorf("invalid config: %w", err)
 	}
 
-	fiberSource := fiber.NewFiberSource(config.fiberEndpoints, config.fiberKey)
-	if err := fiberSource.Connect(); err != nil {
+	fiberSource, err := newFiberSource(config)
+	if err != nil {
+		return err
+	}
+
+	if err := fiberSource.Connect(ctx); err != nil {
+		return err
+	}
+
+	source, err := newOtherSource(config)
+	if err != nil {
 		return err
 	}
 
-	var otherSource BlockSource
-	var otherSourceName string
+	other := &otherStream[types.BlockObservation]{logger: logger}
+	if source == nil {
+		logger.Warn().Msg("No source to compare against, running in Fiber-only mode")
+	} else {
+		otherSource, ok := source.(sources.BlockSource)
+		if !ok || !sources.Has(source, sources.Blocks) {
+			return fmt.Errorf("the %s source doesn't support blocks", source.Name())
+		}
+
+		// The source is subscribed to again before every interval, so it's fine if it can't be reached yet
+		if err := otherSource.Connect(ctx); err != nil {
+			logger.Warn().Err(err).Str("source", otherSource.Name()).Msg("Failed to connect")
+		}
 
-	if config.blxrEndpoint != "" && config.blxrKey != "" {
-		otherSource = bloxroute.NewBloxrouteSource(config.blxrEndpoint, config.blxrKey)
-		otherSourceName = "bloxroute"
+		other.source = otherSource
+		other.subscribe = otherSource.SubscribeBlockObservations
 	}
 
-	sink, err := setupSink(config, sinks.Blocks)
+	sink, err := setupSink(ctx, config, sinks.Blocks)
 	if err != nil {
 		return err
 	}
@@ -57,27 +79,72 @@ func runBlockBenchmark(config *config) error {
 		config:          config,
 		logger:          logger,
 		fiberSource:     fiberSource,
-		otherSource:     otherSource,
-		otherSourceName: otherSourceName,
+		other:           other,
+		otherSourceName: other.name(),
 		sink:            sink,
 	}
 
-	benchmarker.Run()
-
-	return nil
+	return benchmarker.Run(ctx)
 }
 
-func (b *BlockBenchmarker) Run() {
-	var (
-		fiberStream = b.fiberSource.SubscribeBlockObservations()
-		otherStream = b.otherSource.SubscribeBlockObservations()
-	)
-
+// Run runs the benchmark until all intervals are done, a stream is closed or the context is canceled. On an
+// interrupt, the current interval is discarded and the sinks are still flushed. The run metadata is recorded
+// when the benchmark starts and when it's done.
+func (b *BlockBenchmarker) Run(ctx context.Context) (err error) {
+	defer b.sink.Close()
 	defer b.fiberSource.Close()
+	defer b.other.close()
+
+	// Sinks are flushed with the parent context, which isn't canceled by the interrupt
+	sinkCtx := ctx
+	ctx, stop := interruptible(ctx)
+	defer stop()
+
+	metadata := newRunMetadata(b.config, sinks.Blocks, b.other.source)
+	recordRunMetadata(sinkCtx, b.logger, b.sink, metadata)
+	defer func() {
+		finishRunMetadata(metadata, ctx.Err() != nil, err)
+		recordRunMetadata(sinkCtx, b.logger, b.sink, metadata)
+	}()
+
+	fiberStream, err := b.fiberSource.SubscribeBlockObservations(ctx)
+	if err != nil {
+		return fmt.Errorf("subscribing to fiber: %w", err)
+	}
+
+	b.other.resubscribe(ctx)
+
+	if b.config.warmup > 0 {
+		b.logger.Info().Str("duration", b.config.warmup.String()).Msg("Warming up")
+		w := newWarmUp(ctx, b.config.warmup)
+		discard(w, "fiber", fiberStream)
+		discard(w, b.otherSourceName, b.other.ch)
+		for name, n := range w.wait() {
+			b.logger.Info().Str("stream", name).Int("discarded", n).Msg("Warm-up complete")
+		}
+	}
+
+	monitor := health.NewMonitor(b.config.healthSampleInterval, b.config.healthThresholds)
+	health.Watch(monitor, "fiber", fiberStream)
+	health.Watch(monitor, b.otherSourceName, b.other.ch)
+	monitor.Start()
+	defer monitor.Stop()
+
 	for i := 0; i < b.config.intervalCount; i++ {
+		if b.other.resubscribe(ctx) {
+			health.Watch(monitor, b.otherSourceName, b.other.ch)
+		}
+
 		start := time.Now()
 		b.logger.Info().Int("interval", i+1).Msg("Running benchmark interval")
-		stats, err := b.runInterval(fiberStream, otherStream)
+		stats, err := b.runInterval(ctx, fiberStream)
+		if ctx.Err() != nil {
+			b.logger.Warn().Int("interval", i+1).Msg("Benchmark interrupted, discarding the current interval")
+			return nil
+		}
+		if errors.Is(err, errStreamClosed) {
+			return err
+		}
 		if err != nil {
 			b.logger.Error().Err(err).Msg("Failed to run interval")
 		}
@@ -85,55 +152,85 @@ func (b *BlockBenchmarker) Run() {
 		stats.StartTime = start
 		stats.EndTime = end
 		stats.BenchmarkID = b.config.benchmarkID
+		applyHealth(b.logger, &stats, monitor.Collect())
+		b.printSourceHealth()
 		b.sink.RecordBlockStats(&stats)
-		if err := b.sink.Flush(); err != nil {
+		metadata.Intervals++
+		if stats.Tainted {
+			metadata.TaintedIntervals++
+		}
+		if err := b.sink.Flush(sinkCtx); err != nil {
 			b.logger.Error().Err(err).Msg("Failed to flush sink")
 		}
 	}
 
 	b.logger.Info().Msg("Benchmark complete")
+	return nil
+}
+
+func (b *BlockBenchmarker) printSourceHealth() {
+	if b.other.source == nil {
+		printSourceHealth(b.logger, b.fiberSource)
+		return
+	}
+
+	printSourceHealth(b.logger, b.fiberSource, b.other.source)
 }
 
-// Runs the interval
-func (b *BlockBenchmarker) runInterval(fiberStream, otherStream chan types.BlockObservation) (types.ObservationStatsRow, error) {
+// Runs the interval. The other source only counts as live if its stream was open for the whole interval.
+func (b *BlockBenchmarker) runInterval(ctx context.Context, fiberStream chan types.BlockObservation) (types.ObservationStatsRow, error) {
 	// Setup
 	var (
 		fiberMap = make(map[common.Hash]types.BlockObservation)
 		otherMap = make(map[common.Hash]types.BlockObservation)
+
+		fiberDups = newDuplicates()
+		otherDups = newDuplicates()
 	)
 
 	// Initialize interval timer
 	timer := time.NewTimer(b.config.interval)
 
-	b.logger.Info().Int("fiber", len(fiberStream)).Int("other", len(otherStream)).Msg("Buffered observations")
+	b.logger.Info().Int("fiber", len(fiberStream)).Int("other", len(b.other.ch)).Msg("Buffered observations")
+
+	otherLive := b.other.live()
 
 loop:
 	for {
 		select {
 		case <-timer.C:
 			break loop
-		case fiberObs := <-fiberStream:
-			// If we're not in the tail window, continue as usual
-			if _, ok := fiberMap[fiberObs.Hash]; !ok {
+		case <-ctx.Done():
+			return types.ObservationStatsRow{}, ctx.Err()
+		case fiberObs, ok := <-fiberStream:
+			if !ok {
+				return types.ObservationStatsRow{}, streamClosed(b.fiberSource)
+			}
+
+			// Only the first observation is kept, repeats are counted
+			if !fiberDups.observe(fiberObs.Hash, fiberObs.WireTimestamp) {
 				fiberMap[fiberObs.Hash] = fiberObs
-			} else {
-				b.logger.Warn().Str("hash", fiberObs.Hash.Hex()).Str("source", "fiber").Msg("Duplicate hash during interval")
 			}
-		case otherObs := <-otherStream:
-			if _, ok := otherMap[otherObs.Hash]; !ok {
+		case otherObs, ok := <-b.other.ch:
+			if !ok {
+				b.other.closed()
+				otherLive = false
+				continue
+			}
+
+			if !otherDups.observe(otherObs.Hash, otherObs.WireTimestamp) {
 				otherMap[otherObs.Hash] = otherObs
-			} else {
-				b.logger.Warn().Str("hash", otherObs.Hash.Hex()).Str("source", b.otherSourceName).Msg("Duplicate hash during interval")
 			}
 		}
 	}
 
-	return b.processIntervalResults(fiberMap, otherMap)
+	return b.processIntervalResults(fiberMap, otherMap, fiberDups, otherDups, otherLive)
 }
 
-func (b *BlockBenchmarker) processIntervalResults(fiberMap, otherMap map[common.Hash]types.BlockObservation) (types.ObservationStatsRow, error) {
+func (b *BlockBenchmarker) processIntervalResults(fiberMap, otherMap map[common.Hash]types.BlockObservation, fiberDups, otherDups *duplicates, otherLive bool) (types.ObservationStatsRow, error) {
 	diffMap := make(map[common.Hash]float64, len(fiberMap))
 	differences := make([]float64, 0, len(fiberMap))
+	outliers := 0
 
 	for hash, fiberObs := range fiberMap {
 		otherSaw := false
@@ -145,6 +242,14 @@ func (b *BlockBenchmarker) processIntervalResults(fiberMap, otherMap map[common.
 
 		fiberTs := fiberObs.Timestamp
 		otherTs := otherObs.Timestamp
+		fiberWireTs := fiberObs.WireTimestamp
+		otherWireTs := otherObs.WireTimestamp
+
+		if otherSaw && b.config.isOutlier(otherTs-fiberTs) {
+			b.logger.Debug().Str("hash", hash.Hex()).Int64("diff", otherTs-fiberTs).Msg("Discarding outlier")
+			outliers++
+			continue
+		}
 
 		switch {
 		case otherSaw:
@@ -156,56 +261,99 @@ func (b *BlockBenchmarker) processIntervalResults(fiberMap, otherMap map[common.
 
 			if b.sink != nil {
 				b.sink.RecordBlockObservationRow(&types.BlockObservationRow{
-					BlockHash:       hash.Hex(),
-					FiberTimestamp:  fiberTs,
-					OtherTimestamp:  otherTs,
-					Difference:      microDiff,
-					BenchmarkID:     b.config.benchmarkID,
-					TransactionsLen: int64(fiberObs.TransactionsLen),
+					BlockHash:          hash.Hex(),
+					FiberTimestamp:     fiberTs,
+					OtherTimestamp:     otherTs,
+					FiberWireTimestamp: fiberWireTs,
+					OtherWireTimestamp: otherWireTs,
+					Difference:         microDiff,
+					BenchmarkID:        b.config.benchmarkID,
+					TransactionsLen:    int64(fiberObs.TransactionsLen),
+
+					FiberDuplicates:        fiberDups.repeatsOf(hash),
+					OtherDuplicates:        otherDups.repeatsOf(hash),
+					FiberLastWireTimestamp: fiberDups.latestOf(hash),
+					OtherLastWireTimestamp: otherDups.latestOf(hash),
 				})
 			}
 
 		case !otherSaw:
 			// Only Fiber saw the transaction
-			if b.config.logMissing {
+			if b.config.logMissing && otherLive {
 				b.logger.Warn().Str("hash", hash.Hex()).Msg(fmt.Sprintf("Fiber saw block but %s did not", b.otherSourceName))
 			}
 
 			if b.sink != nil {
 				b.sink.RecordBlockObservationRow(&types.BlockObservationRow{
-					BlockHash:       hash.Hex(),
-					FiberTimestamp:  fiberTs,
-					OtherTimestamp:  0,
-					Difference:      0,
-					BenchmarkID:     b.config.benchmarkID,
-					TransactionsLen: int64(fiberObs.TransactionsLen),
+					BlockHash:          hash.Hex(),
+					FiberTimestamp:     fiberTs,
+					OtherTimestamp:     0,
+					FiberWireTimestamp: fiberWireTs,
+					OtherWireTimestamp: 0,
+					Difference:         0,
+					BenchmarkID:        b.config.benchmarkID,
+					TransactionsLen:    int64(fiberObs.TransactionsLen),
+
+					FiberDuplicates:        fiberDups.repeatsOf(hash),
+					OtherDuplicates:        otherDups.repeatsOf(hash),
+					FiberLastWireTimestamp: fiberDups.latestOf(hash),
+					OtherLastWireTimestamp: otherDups.latestOf(hash),
+					OtherDown:              !otherLive,
 				})
 			}
 		}
 	}
 
-	if b.config.sink != "clickhouse" {
-		fmt.Println(types.MakeHistogram(differences))
+	fiberRate := rate(len(fiberMap), b.config.interval)
+	printAbsoluteStats(b.logger, "fiber", fiberRate, 0, 0)
+	fiberDups.print(b.logger, "fiber")
+	printDecodeOverhead(b.logger, "fiber", blockDecodeOverheads(fiberMap))
+
+	if !otherLive {
+		b.logger.Warn().Msg(fmt.Sprintf("%s wasn't live for the whole interval, only reporting Fiber stats", b.otherSourceName))
+
+		return types.ObservationStatsRow{
+			FiberDuplicateRate: fiberDups.rate(),
+			FiberRate:          fiberRate,
+			LiveSources:        liveSources("fiber", b.otherSourceName, false),
+		}, nil
+	}
+
+	otherRate := rate(len(otherMap), b.config.interval)
+
+	if !b.config.hasSink("clickhouse") {
+		fmt.Fprintln(log.Console, types.MakeHistogram(b.config.histogram, differences))
 		b.logger.Info().Msg(fmt.Sprintf("fiber total observations: %d", len(fiberMap)))
 		b.logger.Info().Msg(fmt.Sprintf("%s total observations: %d", b.otherSourceName, len(otherMap)))
 	}
 
 	b.printStats(differences)
+	printOutliers(b.logger, outliers)
+	printAbsoluteStats(b.logger, b.otherSourceName, otherRate, 0, 0)
+	otherDups.print(b.logger, b.otherSourceName)
+	printDecodeOverhead(b.logger, b.otherSourceName, blockDecodeOverheads(otherMap))
+
+	stats, err := buildBlockObservationStats(differences, b.config.deadBand())
+	stats.Outliers = int64(outliers)
+	stats.FiberDuplicateRate = fiberDups.rate()
+	stats.OtherDuplicateRate = otherDups.rate()
+	stats.FiberRate, stats.OtherRate = fiberRate, otherRate
+	stats.LiveSources = liveSources("fiber", b.otherSourceName, true)
+
+	return stats, err
+}
+
+// blockDecodeOverheads returns the time between the wire and decoded timestamps of all observations in microseconds.
+func blockDecodeOverheads(observations map[common.Hash]types.BlockObservation) []float64 {
+	overheads := make([]float64, 0, len(observations))
+	for _, obs := range observations {
+		overheads = append(overheads, float64(obs.Timestamp-obs.WireTimestamp))
+	}
 
-	return buildBlockObservationStats(differences)
+	return overheads
 }
 
 func (b *BlockBenchmarker) printStats(differences []float64) {
-	fiberWon := float64(0)
-	blxrWon := float64(0)
-
-	for _, diff := range differences {
-		if diff > 0 {
-			fiberWon++
-		} else {
-			blxrWon++
-		}
-	}
 	mean, err := stats.Mean(differences)
 	if err != nil {
 		b.logger.Error().Err(err).Msg("Failed to calculate mean")
@@ -236,6 +384,6 @@ func (b *BlockBenchmarker) printStats(differences []float64) {
 	b.logger.Info().Msg(fmt.Sprintf("Stdev: %.4fms", stdev))
 	b.logger.Info().Msg(fmt.Sprintf("Min: %.4fms | Max: %.4fms", min, max))
 
-	wonRatio := fiberWon / (fiberWon + blxrWon)
-	b.logger.Info().Msg(fmt.Sprintf("Fiber won: %.2f%%", wonRatio*100))
+	fiberWon, otherWon, tied := types.CountOutcomes(differences, b.config.deadBand()).Ratios()
+	b.logger.Info().Msg(fmt.Sprintf("Fiber won: %.2f%% | %s won: %.2f%% | Tied: %.2f%%", fiberWon*100, b.otherSourceName, otherWon*100, tied*100))
 }
@@ -0,0 +1,34 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+const (
+	// Status bits of adjtimex: the clock isn't synchronized, and the offset is in nanoseconds
+	staUnsync = 0x0040
+	staNano   = 0x2000
+	// State returned by adjtimex if the clock isn't synchronized
+	timeError = 5
+)
+
+// readClockSync reads the synchronization of the system clock that the kernel maintains for NTP or chrony.
+func readClockSync() clockSync {
+	var timex syscall.Timex
+	state, err := syscall.Adjtimex(&timex)
+	if err != nil {
+		return unknownClockSync
+	}
+
+	offset := int64(timex.Offset)
+	if timex.Status&staNano != 0 {
+		offset /= 1000
+	}
+
+	return clockSync{
+		synced:   state != timeError && timex.Status&staUnsync == 0,
+		offset:   offset,
+		estError: int64(timex.Esterror),
+		maxError: int64(timex.Maxerror),
+	}
+}
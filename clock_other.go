@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// readClockSync is only supported on Linux.
+func readClockSync() clockSync {
+	return unknownClockSync
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainbound/fiber-benchmarks/compare"
+	"github.com/chainbound/fiber-benchmarks/log"
+)
+
+// compareRuns compares a candidate run against a baseline, and returns an error if any metric regressed
+// beyond the thresholds.
+func compareRuns(ctx context.Context, config *config, from, baseline, candidate string, thresholds compare.Thresholds) error {
+	logger := log.NewLogger("compare")
+
+	baselineRun, err := loadRun(ctx, config, from, baseline)
+	if err != nil {
+		return fmt.Errorf("loading baseline: %w", err)
+	}
+
+	candidateRun, err := loadRun(ctx, config, from, candidate)
+	if err != nil {
+		return fmt.Errorf("loading candidate: %w", err)
+	}
+
+	result, err := compare.Compare(baselineRun, candidateRun, config.deadBand(), thresholds)
+	if err != nil {
+		return err
+	}
+
+	logger.Info().Int("baseline", result.BaselineCount).Int("candidate", result.CandidateCount).Msg("Transactions seen by both sources")
+
+	for _, change := range result.Changes {
+		unit := "ms"
+		if change.Metric == "fiber won" {
+			unit = "%"
+		}
+
+		msg := fmt.Sprintf("%-9s baseline: %9.4f%s | candidate: %9.4f%s | delta: %+9.4f%s | p-value: %.4f", change.Metric, change.Baseline, unit, change.Candidate, unit, change.Delta, unit, change.PValue)
+
+		switch {
+		case change.Regression:
+			logger.Error().Msg(msg + " | REGRESSION")
+		case change.Significant:
+			logger.Info().Msg(msg + " | significant")
+		default:
+			logger.Info().Msg(msg)
+		}
+	}
+
+	if regressions := result.Regressions(); len(regressions) > 0 {
+		return fmt.Errorf("%d metrics regressed beyond the thresholds", len(regressions))
+	}
+
+	logger.Info().Msg("No regressions")
+	return nil
+}
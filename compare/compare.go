@@ -0,0 +1,153 @@
+// Package compare compares two transaction benchmark runs and detects statistically significant regressions.
+package compare
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// Percentiles of the differences that are compared
+var Percentiles = []float64{5, 25, 50, 75, 95, 99}
+
+// z-score of the 95% confidence interval of a quantile, used to estimate its standard error
+const z95 = 1.959964
+
+// Thresholds at which a significant change counts as a regression. Differences are other - Fiber, so
+// a regression is a decrease.
+type Thresholds struct {
+	// Maximum decrease of any percentile in milliseconds
+	Percentile float64
+	// Maximum decrease of the Fiber win ratio in percentage points
+	WinRatio float64
+	// Changes with a p-value below this are significant
+	Alpha float64
+}
+
+// Change is the change of a single metric between the baseline and the candidate.
+type Change struct {
+	Metric    string
+	Baseline  float64
+	Candidate float64
+	// Candidate - baseline
+	Delta  float64
+	PValue float64
+
+	Significant bool
+	Regression  bool
+}
+
+// Result of a comparison.
+type Result struct {
+	BaselineCount  int
+	CandidateCount int
+	Changes        []Change
+}
+
+// Regressions returns the changes that crossed a threshold.
+func (r *Result) Regressions() []Change {
+	var regressions []Change
+	for _, change := range r.Changes {
+		if change.Regression {
+			regressions = append(regressions, change)
+		}
+	}
+
+	return regressions
+}
+
+// Compare compares the differences of the transactions that were seen by both sources in each run.
+// Percentiles are compared with a z-test using distribution-free standard errors of the quantiles,
+// and the win ratio with a two-proportion z-test. Differences of at most deadBand milliseconds are ties.
+func Compare(baseline, candidate *types.Run, deadBand float64, thresholds Thresholds) (*Result, error) {
+	a := differences(baseline)
+	b := differences(candidate)
+
+	if len(a) == 0 {
+		return nil, fmt.Errorf("baseline %s has no transactions that were seen by both sources", baseline.BenchmarkID)
+	}
+
+	if len(b) == 0 {
+		return nil, fmt.Errorf("candidate %s has no transactions that were seen by both sources", candidate.BenchmarkID)
+	}
+
+	result := &Result{BaselineCount: len(a), CandidateCount: len(b)}
+
+	for _, p := range Percentiles {
+		qa, sea := quantile(a, p/100)
+		qb, seb := quantile(b, p/100)
+
+		change := Change{
+			Metric:    fmt.Sprintf("p%.0f", p),
+			Baseline:  qa,
+			Candidate: qb,
+			Delta:     qb - qa,
+			PValue:    pValue(qb-qa, math.Sqrt(sea*sea+seb*seb)),
+		}
+
+		change.Significant = change.PValue < thresholds.Alpha
+		change.Regression = change.Significant && -change.Delta > thresholds.Percentile
+		result.Changes = append(result.Changes, change)
+	}
+
+	wa := float64(types.CountOutcomes(a, deadBand).FiberWon)
+	wb := float64(types.CountOutcomes(b, deadBand).FiberWon)
+	na, nb := float64(len(a)), float64(len(b))
+	pooled := (wa + wb) / (na + nb)
+
+	change := Change{
+		Metric:    "fiber won",
+		Baseline:  wa / na * 100,
+		Candidate: wb / nb * 100,
+	}
+	change.Delta = change.Candidate - change.Baseline
+	change.PValue = pValue(wb/nb-wa/na, math.Sqrt(pooled*(1-pooled)*(1/na+1/nb)))
+	change.Significant = change.PValue < thresholds.Alpha
+	change.Regression = change.Significant && -change.Delta > thresholds.WinRatio
+	result.Changes = append(result.Changes, change)
+
+	return result, nil
+}
+
+// differences returns the sorted differences in milliseconds of the transactions that were seen by both sources.
+func differences(run *types.Run) []float64 {
+	var differences []float64
+	for _, row := range run.Observations {
+		if row.FiberTimestamp != 0 && row.OtherTimestamp != 0 {
+			differences = append(differences, float64(row.Difference)/1000)
+		}
+	}
+
+	sort.Float64s(differences)
+	return differences
+}
+
+// quantile returns the q-quantile of the sorted values and its standard error, which is estimated
+// from the width of the order statistic confidence interval.
+func quantile(sorted []float64, q float64) (float64, float64) {
+	n := float64(len(sorted))
+	at := func(rank float64) float64 {
+		i := int(math.Max(0, math.Min(n-1, rank)))
+		return sorted[i]
+	}
+
+	spread := z95 * math.Sqrt(n*q*(1-q))
+	lower := at(math.Floor(n*q - spread))
+	upper := at(math.Ceil(n*q + spread))
+
+	return at(math.Ceil(n*q) - 1), (upper - lower) / (2 * z95)
+}
+
+// pValue returns the two-sided p-value of a difference with the given standard error.
+func pValue(delta, se float64) float64 {
+	if se == 0 {
+		if delta == 0 {
+			return 1
+		}
+		return 0
+	}
+
+	return math.Erfc(math.Abs(delta/se) / math.Sqrt2)
+}
@@ -0,0 +1,213 @@
+package compare
+
+import (
+	"math"
+	"testing"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+var thresholds = Thresholds{Percentile: 1, WinRatio: 5, Alpha: 0.01}
+
+// uniformRun returns a run with n differences evenly spread over [0, 20) milliseconds, shifted by shift.
+func uniformRun(id string, n int, shift float64) *types.Run {
+	run := &types.Run{BenchmarkID: id}
+	for i := 0; i < n; i++ {
+		diff := float64(i)*20/float64(n) + shift
+		run.Observations = append(run.Observations, &types.ConfirmedObservationRow{
+			FiberTimestamp: 1,
+			OtherTimestamp: 1,
+			Difference:     int64(math.Round(diff * 1000)),
+		})
+	}
+
+	return run
+}
+
+func change(t *testing.T, result *Result, metric string) Change {
+	t.Helper()
+
+	for _, change := range result.Changes {
+		if change.Metric == metric {
+			return change
+		}
+	}
+
+	t.Fatalf("no change for %s", metric)
+	return Change{}
+}
+
+func TestCompareNoRegression(t *testing.T) {
+	result, err := Compare(uniformRun("a", 10000, 0), uniformRun("b", 10000, 0), 0, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, change := range result.Changes {
+		if change.Delta != 0 || change.PValue != 1 || change.Significant || change.Regression {
+			t.Errorf("%s: identical runs should not change, got %+v", change.Metric, change)
+		}
+	}
+
+	if len(result.Regressions()) != 0 {
+		t.Errorf("expected no regressions, got %+v", result.Regressions())
+	}
+}
+
+func TestCompareRegression(t *testing.T) {
+	result, err := Compare(uniformRun("a", 10000, 0), uniformRun("b", 10000, -10), 0, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"p5", "p25", "p50", "p75", "p95", "p99"} {
+		c := change(t, result, p)
+		if math.Abs(c.Delta+10) > 0.01 {
+			t.Errorf("%s: expected a delta of -10ms, got %f", p, c.Delta)
+		}
+		if !c.Regression {
+			t.Errorf("%s: expected a regression, got %+v", p, c)
+		}
+	}
+
+	won := change(t, result, "fiber won")
+	if math.Abs(won.Delta+50) > 0.1 || !won.Regression {
+		t.Errorf("fiber won: expected a regression of 50 points, got %+v", won)
+	}
+
+	if len(result.Regressions()) != len(Percentiles)+1 {
+		t.Errorf("expected every metric to regress, got %d regressions", len(result.Regressions()))
+	}
+}
+
+func TestCompareImprovement(t *testing.T) {
+	result, err := Compare(uniformRun("a", 10000, 0), uniformRun("b", 10000, 10), 0, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !change(t, result, "p50").Significant {
+		t.Error("p50: expected a significant change")
+	}
+
+	if len(result.Regressions()) != 0 {
+		t.Errorf("improvements aren't regressions, got %+v", result.Regressions())
+	}
+}
+
+func TestCompareThresholds(t *testing.T) {
+	// Significant with this many samples, but smaller than the thresholds
+	result, err := Compare(uniformRun("a", 10000, 0), uniformRun("b", 10000, -0.5), 0, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p50 := change(t, result, "p50")
+	if !p50.Significant || p50.Regression {
+		t.Errorf("p50: expected a significant change below the threshold, got %+v", p50)
+	}
+
+	won := change(t, result, "fiber won")
+	if !won.Significant || won.Regression {
+		t.Errorf("fiber won: expected a significant change below the threshold, got %+v", won)
+	}
+
+	// The same shift is a regression once it crosses the thresholds
+	strict := Thresholds{Percentile: 0.1, WinRatio: 1, Alpha: 0.01}
+	if result, err = Compare(uniformRun("a", 10000, 0), uniformRun("b", 10000, -0.5), 0, strict); err != nil {
+		t.Fatal(err)
+	}
+
+	if !change(t, result, "p50").Regression || !change(t, result, "fiber won").Regression {
+		t.Errorf("expected regressions with strict thresholds, got %+v", result.Changes)
+	}
+}
+
+func TestCompareNotSignificant(t *testing.T) {
+	// A large shift of a few samples isn't significant
+	result, err := Compare(uniformRun("a", 20, 0), uniformRun("b", 20, -2), 0, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p50 := change(t, result, "p50")
+	if p50.Significant || p50.Regression {
+		t.Errorf("p50: expected no significant change with few samples, got %+v", p50)
+	}
+}
+
+func TestCompareDeadBand(t *testing.T) {
+	// Differences of up to 5ms are ties, which aren't counted as Fiber wins
+	result, err := Compare(uniformRun("a", 10000, 0), uniformRun("b", 10000, 0), 5, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	won := change(t, result, "fiber won")
+	if math.Abs(won.Baseline-75) > 0.1 {
+		t.Errorf("fiber won: expected 75%% outside the dead-band, got %f", won.Baseline)
+	}
+}
+
+func TestCompareIgnoresMissing(t *testing.T) {
+	baseline := uniformRun("a", 100, 0)
+	baseline.Observations = append(baseline.Observations, &types.ConfirmedObservationRow{FiberTimestamp: 1, Difference: -1000000})
+
+	result, err := Compare(baseline, uniformRun("b", 100, 0), 0, thresholds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.BaselineCount != 100 {
+		t.Errorf("expected transactions that weren't seen by both sources to be ignored, got %d", result.BaselineCount)
+	}
+
+	if _, err := Compare(&types.Run{BenchmarkID: "empty"}, baseline, 0, thresholds); err == nil {
+		t.Error("expected an error for a run without transactions seen by both sources")
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := make([]float64, 100)
+	for i := range sorted {
+		sorted[i] = float64(i + 1)
+	}
+
+	for _, tc := range []struct {
+		q    float64
+		want float64
+	}{
+		{0.05, 5},
+		{0.5, 50},
+		{0.99, 99},
+	} {
+		got, se := quantile(sorted, tc.q)
+		if got != tc.want {
+			t.Errorf("quantile(%v) = %v, want %v", tc.q, got, tc.want)
+		}
+		if se <= 0 {
+			t.Errorf("quantile(%v) has standard error %v, want > 0", tc.q, se)
+		}
+	}
+
+	if _, se := quantile([]float64{3, 3, 3, 3}, 0.5); se != 0 {
+		t.Errorf("constant values should have a standard error of 0, got %v", se)
+	}
+}
+
+func TestPValue(t *testing.T) {
+	for _, tc := range []struct {
+		delta, se, want float64
+	}{
+		{0, 1, 1},
+		{1.959964, 1, 0.05},
+		{-1.959964, 1, 0.05},
+		{2.575829, 1, 0.01},
+		{0, 0, 1},
+		{1, 0, 0},
+	} {
+		if got := pValue(tc.delta, tc.se); math.Abs(got-tc.want) > 1e-4 {
+			t.Errorf("pValue(%v, %v) = %v, want %v", tc.delta, tc.se, got, tc.want)
+		}
+	}
+}
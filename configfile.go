@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/chainbound/fiber-benchmarks/log"
+	"github.com/chainbound/fiber-benchmarks/sinks/jsonl"
+	"github.com/chainbound/fiber-benchmarks/sources"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// fileConfig is the layout of a YAML config file. Sources and sinks are defined once by name,
+// and profiles pick which of them to use together with benchmark parameters.
+//
+// Values in the file have the lowest precedence: environment variables and CLI flags override them.
+// Environment variables in the form of ${VAR} are expanded in values, so secrets don't have to live in the file.
+// Other uses of `$` are kept, and variables that aren't set are an error.
+type fileConfig struct {
+	// Profile to use if none is given with --profile
+	Profile   string                   `yaml:"profile"`
+	Sources   map[string]sourceConfig  `yaml:"sources"`
+	Sinks     map[string]sinkConfig    `yaml:"sinks"`
+	Benchmark benchmarkConfig          `yaml:"benchmark"`
+	Profiles  map[string]profileConfig `yaml:"profiles"`
+}
+
+// sourceConfig is instantiated through the source registry, so any registered type can be used.
+type sourceConfig struct {
+	// Registered type, e.g. 'fiber', 'bloxroute', 'jsonrpc', 'devp2p'
+	Type      string   `yaml:"type"`
+	Endpoint  string   `yaml:"endpoint"`
+	Endpoints []string `yaml:"endpoints"`
+	Key       string   `yaml:"key"`
+	// All other keys are options of the type, e.g. 'transport' of bloxroute or 'method' of jsonrpc
+	Options map[string]any `yaml:",inline"`
+}
+
+// registryConfig returns the registry config of the source with the given name.
+func (s sourceConfig) registryConfig(name string) sources.Config {
+	config := sources.Config{
+		Type:      s.Type,
+		Name:      name,
+		Endpoints: append([]string{}, s.Endpoints...),
+		Key:       s.Key,
+		Options:   make(map[string]any, len(s.Options)),
+	}
+
+	if s.Endpoint != "" {
+		config.Endpoints = append(config.Endpoints, s.Endpoint)
+	}
+
+	for key, value := range s.Options {
+		config.Options[key] = value
+	}
+
+	return config
+}
+
+type sinkConfig struct {
+	// One of 'clickhouse', 'csv', 'jsonl', 'stdout', 'none'
+	Type     string `yaml:"type"`
+	Endpoint string `yaml:"endpoint"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       string `yaml:"db"`
+	File     string `yaml:"file"`
+
+	Timeout    *time.Duration `yaml:"timeout"`
+	MaxRetries *int           `yaml:"max-retries"`
+	Backoff    *time.Duration `yaml:"backoff"`
+	SpillFile  *string        `yaml:"spill-file"`
+
+	ObservationsTTL *time.Duration `yaml:"observations-ttl"`
+	StatsTTL        *time.Duration `yaml:"stats-ttl"`
+
+	// JSONL only: rotation size in megabytes and rotation interval
+	MaxSize        *int           `yaml:"max-size"`
+	RotateInterval *time.Duration `yaml:"rotate-interval"`
+}
+
+// Benchmark parameters. These are pointers so that a profile only overrides the values it sets.
+type benchmarkConfig struct {
+	BenchmarkID   *string        `yaml:"benchmark-id"`
+	Region        *string        `yaml:"region"`
+	Interval      *time.Duration `yaml:"interval"`
+	IntervalCount *int           `yaml:"interval-count"`
+	CrossCheck    *bool          `yaml:"cross-check"`
+	LogMissing    *bool          `yaml:"log-missing"`
+	PerEndpoint   *bool          `yaml:"fiber-per-endpoint"`
+	TieThreshold  *time.Duration `yaml:"tie-threshold"`
+	Warmup        *time.Duration `yaml:"warmup"`
+	MaxAbsDiff    *time.Duration `yaml:"max-abs-diff"`
+}
+
+type profileConfig struct {
+	// Names of the sources to use. All sources are used if empty.
+	Sources []string `yaml:"sources"`
+	// Names of the sinks to write to. Can be omitted if only one sink is defined.
+	Sinks     []string        `yaml:"sinks"`
+	Benchmark benchmarkConfig `yaml:"benchmark"`
+}
+
+func loadFileConfig(path string) (*fileConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variables are expanded in the parsed values, so that a `$` elsewhere in the file, e.g. in a comment, is kept
+	var document yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(raw)).Decode(&document); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if err := expandNode(&document); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	expanded, err := yaml.Marshal(&document)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	var file fileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(expanded))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return &file, nil
+}
+
+var envVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandNode expands environment variables in the values of a YAML document. Keys are left untouched.
+func expandNode(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		value, err := expandEnv(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+
+		if value != node.Value {
+			node.Value = value
+			// Unquoted values are resolved again, so that e.g. numbers and durations can come from the environment
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := expandNode(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := expandNode(child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandEnv replaces every ${VAR} in s with the value of the environment variable. Other uses of `$` are
+// kept as they are, and variables that aren't set are an error.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envVar.ReplaceAllStringFunc(s, func(match string) string {
+		name := envVar.FindStringSubmatch(match)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value
+	})
+
+	return expanded, err
+}
+
+// validate checks all sources, sinks and profiles in the file, not only the ones that are in use.
+func (f *fileConfig) validate() error {
+	// Factories don't connect, so instantiating a source checks its config
+	for name, source := range f.Sources {
+		if _, err := sources.New(source.registryConfig(name)); err != nil {
+			return fmt.Errorf("source %s: %w", name, err)
+		}
+	}
+
+	for name, sink := range f.Sinks {
+		if sink.Type != "none" && sink.Type != "stdout" && sink.Type != "clickhouse" && sink.Type != "csv" && sink.Type != "jsonl" {
+			return fmt.Errorf("sink %s: invalid type: %s", name, sink.Type)
+		}
+	}
+
+	if f.Profile != "" {
+		if _, ok := f.Profiles[f.Profile]; !ok {
+			return fmt.Errorf("default profile %s does not exist", f.Profile)
+		}
+	}
+
+	for name, profile := range f.Profiles {
+		if err := f.checkProfile(profile); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkProfile verifies that all sources and sinks referenced by the profile exist, and that
+// there's at most one source and sink of each type.
+func (f *fileConfig) checkProfile(profile profileConfig) error {
+	sourceTypes := make(map[string]string)
+	for _, name := range profile.Sources {
+		source, ok := f.Sources[name]
+		if !ok {
+			return fmt.Errorf("source %s does not exist", name)
+		}
+
+		if other, ok := sourceTypes[source.Type]; ok {
+			return fmt.Errorf("sources %s and %s are both of type %s", other, name, source.Type)
+		}
+		sourceTypes[source.Type] = name
+	}
+
+	sinkTypes := make(map[string]string)
+	for _, name := range profile.Sinks {
+		sink, ok := f.Sinks[name]
+		if !ok {
+			return fmt.Errorf("sink %s does not exist", name)
+		}
+
+		if other, ok := sinkTypes[sink.Type]; ok {
+			return fmt.Errorf("sinks %s and %s are both of type %s", other, name, sink.Type)
+		}
+		sinkTypes[sink.Type] = name
+	}
+
+	return nil
+}
+
+// load reads the config file (if any) and applies the selected profile to the config. Values
+// that were set with a flag or environment variable are left untouched. Flags that need parsing or are
+// merged with the config file are applied afterwards, so this must only be called once.
+func (c *config) load(ctx *cli.Context) error {
+	c.sourceConfigs = make(map[string]sources.Config)
+
+	if c.configFile != "" {
+		if err := c.loadFile(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := c.applySourceFlags(ctx); err != nil {
+		return err
+	}
+
+	if err := c.selectOtherSource(); err != nil {
+		return err
+	}
+
+	c.sinks = append(c.sinks, c.sinkSlice.Value()...)
+
+	c.histogram.Scale = types.Scale(c.histogramScale)
+	c.histogram.View = types.HistogramView(c.histogramView)
+
+	// JSONL rows on stdout are meant to be piped, so everything else has to go elsewhere
+	if c.hasSink("jsonl") && c.jsonl.File == jsonl.Stdout {
+		log.UseStderr()
+	}
+
+	return nil
+}
+
+// loadFile reads the config file and applies the selected profile.
+func (c *config) loadFile(ctx *cli.Context) error {
+	file, err := loadFileConfig(c.configFile)
+	if err != nil {
+		return err
+	}
+
+	c.file = file
+
+	if c.profile == "" {
+		c.profile = file.Profile
+	}
+
+	var profile profileConfig
+	if c.profile != "" {
+		var ok bool
+		if profile, ok = file.Profiles[c.profile]; !ok {
+			return fmt.Errorf("profile %s does not exist", c.profile)
+		}
+	}
+
+	if len(profile.Sources) == 0 {
+		for name := range file.Sources {
+			profile.Sources = append(profile.Sources, name)
+		}
+	}
+
+	if len(profile.Sinks) == 0 && len(file.Sinks) == 1 {
+		for name := range file.Sinks {
+			profile.Sinks = append(profile.Sinks, name)
+		}
+	}
+
+	if err := file.checkProfile(profile); err != nil {
+		return err
+	}
+
+	for _, name := range profile.Sources {
+		source := file.Sources[name]
+		c.sourceConfigs[source.Type] = source.registryConfig(name)
+	}
+
+	for _, name := range profile.Sinks {
+		c.applySink(ctx, file.Sinks[name])
+	}
+
+	c.applyBenchmark(ctx, file.Benchmark)
+	c.applyBenchmark(ctx, profile.Benchmark)
+
+	return nil
+}
+
+func (c *config) applySink(ctx *cli.Context, sink sinkConfig) {
+	if !ctx.IsSet("sink") {
+		c.sinks = append(c.sinks, sink.Type)
+	}
+
+	switch sink.Type {
+	case "clickhouse":
+		if !ctx.IsSet("clickhouse-endpoint") {
+			c.clickhouse.Endpoint = sink.Endpoint
+		}
+		if !ctx.IsSet("clickhouse-user") && sink.Username != "" {
+			c.clickhouse.Username = sink.Username
+		}
+		if !ctx.IsSet("clickhouse-password") {
+			c.clickhouse.Password = sink.Password
+		}
+		if !ctx.IsSet("clickhouse-db") {
+			c.clickhouse.DB = sink.DB
+		}
+		if sink.Timeout != nil && !ctx.IsSet("clickhouse-timeout") {
+			c.clickhouse.Timeout = *sink.Timeout
+		}
+		if sink.MaxRetries != nil && !ctx.IsSet("clickhouse-max-retries") {
+			c.clickhouse.MaxRetries = *sink.MaxRetries
+		}
+		if sink.Backoff != nil && !ctx.IsSet("clickhouse-backoff") {
+			c.clickhouse.Backoff = *sink.Backoff
+		}
+		if sink.SpillFile != nil && !ctx.IsSet("clickhouse-spill-file") {
+			c.clickhouse.SpillFile = *sink.SpillFile
+		}
+		if sink.ObservationsTTL != nil && !ctx.IsSet("clickhouse-observations-ttl") {
+			c.clickhouse.ObservationsTTL = *sink.ObservationsTTL
+		}
+		if sink.StatsTTL != nil && !ctx.IsSet("clickhouse-stats-ttl") {
+			c.clickhouse.StatsTTL = *sink.StatsTTL
+		}
+	case "csv":
+		if !ctx.IsSet("log-file") {
+			c.logFile = sink.File
+		}
+	case "jsonl":
+		if !ctx.IsSet("jsonl-file") && sink.File != "" {
+			c.jsonl.File = sink.File
+		}
+		if sink.MaxSize != nil && !ctx.IsSet("jsonl-max-size") {
+			c.jsonlMaxSize = *sink.MaxSize
+		}
+		if sink.RotateInterval != nil && !ctx.IsSet("jsonl-rotate-interval") {
+			c.jsonl.RotateInterval = *sink.RotateInterval
+		}
+	}
+}
+
+func (c *config) applyBenchmark(ctx *cli.Context, benchmark benchmarkConfig) {
+	if benchmark.BenchmarkID != nil && !ctx.IsSet("benchmark-id") {
+		c.benchmarkID = *benchmark.BenchmarkID
+	}
+	if benchmark.Region != nil && !ctx.IsSet("region") {
+		c.region = *benchmark.Region
+	}
+	if benchmark.Interval != nil && !ctx.IsSet("interval") {
+		c.interval = *benchmark.Interval
+	}
+	if benchmark.IntervalCount != nil && !ctx.IsSet("interval-count") {
+		c.intervalCount = *benchmark.IntervalCount
+	}
+	if benchmark.CrossCheck != nil && !ctx.IsSet("cross-check") {
+		c.crossCheck = *benchmark.CrossCheck
+	}
+	if benchmark.LogMissing != nil && !ctx.IsSet("log-missing") {
+		c.logMissing = *benchmark.LogMissing
+	}
+	if benchmark.PerEndpoint != nil && !ctx.IsSet("fiber-per-endpoint") {
+		c.perEndpoint = *benchmark.PerEndpoint
+	}
+	if benchmark.TieThreshold != nil && !ctx.IsSet("tie-threshold") {
+		c.tieThreshold = *benchmark.TieThreshold
+	}
+	if benchmark.Warmup != nil && !ctx.IsSet("warmup") {
+		c.warmup = *benchmark.Warmup
+	}
+	if benchmark.MaxAbsDiff != nil && !ctx.IsSet("max-abs-diff") {
+		c.maxAbsDiff = *benchmark.MaxAbsDiff
+	}
+}
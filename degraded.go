@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/rs/zerolog"
+
+	"github.com/chainbound/fiber-benchmarks/sources"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// otherStream is the stream of the source that Fiber is compared against. The source is optional: if it isn't
+// configured, can't be reached or its stream is closed, the benchmark continues in Fiber-only mode, and the
+// source is subscribed to again before every interval.
+type otherStream[T any] struct {
+	logger zerolog.Logger
+	// Nil if no source is configured
+	source    sources.Source
+	subscribe func(ctx context.Context) (chan T, error)
+
+	// Nil while the source is down
+	ch chan T
+}
+
+func (s *otherStream[T]) name() string {
+	if s.source == nil {
+		return "other"
+	}
+
+	return s.source.Name()
+}
+
+// live returns true if the stream is open.
+func (s *otherStream[T]) live() bool {
+	return s.ch != nil
+}
+
+// resubscribe subscribes to the source if it's down, and returns true if it has a new stream.
+func (s *otherStream[T]) resubscribe(ctx context.Context) bool {
+	if s.source == nil || s.ch != nil {
+		return false
+	}
+
+	ch, err := s.subscribe(ctx)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("source", s.name()).Msg("Failed to subscribe, continuing in Fiber-only mode")
+		return false
+	}
+
+	s.logger.Info().Str("source", s.name()).Msg("Subscribed")
+	s.ch = ch
+	return true
+}
+
+// closed marks the stream as down after it was closed.
+func (s *otherStream[T]) closed() {
+	s.ch = nil
+	s.logger.Warn().AnErr("last_error", s.source.Health().Err).Str("source", s.name()).Msg("Stream closed, continuing in Fiber-only mode")
+}
+
+func (s *otherStream[T]) close() {
+	if s.source != nil {
+		s.source.Close()
+	}
+}
+
+// liveSources returns the names of the live sources for the stats.
+func liveSources(fiberName string, otherName string, otherLive bool) []string {
+	if otherLive {
+		return []string{fiberName, otherName}
+	}
+
+	return []string{fiberName}
+}
+
+// rate returns the number of observations per second during the interval.
+func rate(observations int, interval time.Duration) float64 {
+	return float64(observations) / interval.Seconds()
+}
+
+// coverage returns the share of the confirmed transactions that were observed, or 0 if there are none.
+func coverage(observations map[common.Hash]types.Observation, confirmed map[common.Hash]types.Inclusion) float64 {
+	if len(confirmed) == 0 {
+		return 0
+	}
+
+	seen := 0
+	for hash := range confirmed {
+		if _, ok := observations[hash]; ok {
+			seen++
+		}
+	}
+
+	return float64(seen) / float64(len(confirmed))
+}
+
+// printAbsoluteStats prints the stats of a single source that don't need another source to compare against.
+// Coverage is only printed if there are confirmed transactions.
+func printAbsoluteStats(logger zerolog.Logger, source string, rate, coverage float64, confirmed int) {
+	msg := fmt.Sprintf("rate: %.2f/s", rate)
+	if confirmed > 0 {
+		msg += fmt.Sprintf(" | coverage: %.2f%% of %d confirmed", coverage*100, confirmed)
+	}
+
+	logger.Info().Str("source", source).Msg(msg)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/montanaflynn/stats"
+	"github.com/rs/zerolog"
+)
+
+// duplicates tracks repeated observations of the same hash by a single source during an interval. Repeated
+// broadcasts are real signal (re-announcements), but can also point at deduplication bugs, e.g. in the multiplexer.
+type duplicates struct {
+	// Number of observations per hash, including the first
+	counts map[common.Hash]int
+	// Wire timestamp of the earliest and latest observation per hash
+	first  map[common.Hash]int64
+	latest map[common.Hash]int64
+	// Number of observations that were repeats
+	repeats int
+	// Gaps between consecutive observations of the same hash in milliseconds
+	gaps []float64
+}
+
+func newDuplicates() *duplicates {
+	return &duplicates{
+		counts: make(map[common.Hash]int),
+		first:  make(map[common.Hash]int64),
+		latest: make(map[common.Hash]int64),
+	}
+}
+
+// observe records an observation with a wire timestamp in microseconds, and returns true if the hash was
+// already observed.
+func (d *duplicates) observe(hash common.Hash, wireTs int64) bool {
+	d.counts[hash]++
+
+	latest, seen := d.latest[hash]
+	if seen {
+		d.repeats++
+		d.gaps = append(d.gaps, float64(wireTs-latest)/1000)
+	}
+
+	if !seen || wireTs > latest {
+		d.latest[hash] = wireTs
+	}
+
+	if first, ok := d.first[hash]; !ok || wireTs < first {
+		d.first[hash] = wireTs
+	}
+
+	return seen
+}
+
+// repeatsOf returns how many times the hash was observed after the first time.
+func (d *duplicates) repeatsOf(hash common.Hash) int64 {
+	if d.counts[hash] == 0 {
+		return 0
+	}
+
+	return int64(d.counts[hash] - 1)
+}
+
+// latestOf returns the wire timestamp of the latest observation of the hash, or 0 if it wasn't observed.
+func (d *duplicates) latestOf(hash common.Hash) int64 {
+	return d.latest[hash]
+}
+
+// rate returns the number of repeats per unique hash.
+func (d *duplicates) rate() float64 {
+	if len(d.counts) == 0 {
+		return 0
+	}
+
+	return float64(d.repeats) / float64(len(d.counts))
+}
+
+// mergeDuplicates merges the duplicates of separate connections to the same source, e.g. Fiber endpoints.
+// Only repeats within a connection count. The latest timestamp of a hash that wasn't repeated is the
+// earliest timestamp across the connections, like it would be for a single connection.
+func mergeDuplicates(ds []*duplicates) *duplicates {
+	merged := newDuplicates()
+
+	for _, d := range ds {
+		for hash, count := range d.counts {
+			if merged.counts[hash] == 0 {
+				merged.counts[hash] = 1
+			}
+			merged.counts[hash] += count - 1
+		}
+
+		merged.repeats += d.repeats
+		merged.gaps = append(merged.gaps, d.gaps...)
+	}
+
+	for hash := range merged.counts {
+		var earliest, latest int64
+		for _, d := range ds {
+			ts, ok := d.latest[hash]
+			if !ok {
+				continue
+			}
+
+			if d.counts[hash] > 1 && ts > latest {
+				latest = ts
+			}
+
+			if first := d.first[hash]; earliest == 0 || first < earliest {
+				earliest = first
+			}
+		}
+
+		merged.first[hash] = earliest
+		merged.latest[hash] = latest
+		if latest == 0 {
+			merged.latest[hash] = earliest
+		}
+	}
+
+	return merged
+}
+
+func (d *duplicates) print(logger zerolog.Logger, source string) {
+	if d.repeats == 0 {
+		logger.Info().Str("source", source).Msg("No duplicates")
+		return
+	}
+
+	p50, _ := stats.Median(d.gaps)
+	max, _ := stats.Max(d.gaps)
+
+	logger.Warn().Str("source", source).Msg(fmt.Sprintf("Duplicates: %d (%.2f%%) | gap p50: %.1fms | max: %.1fms", d.repeats, d.rate()*100, p50, max))
+}
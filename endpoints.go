@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/chainbound/fiber-benchmarks/sources/fiber"
+	"github.com/chainbound/fiber-benchmarks/types"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/montanaflynn/stats"
+)
+
+// Per-endpoint results for a single interval
+type endpointResult struct {
+	// Number of confirmed transactions this endpoint saw
+	seen int
+	// Number of confirmed transactions this endpoint saw first, by more than the dead-band
+	won int
+	// Number of confirmed transactions this endpoint saw within the dead-band of another endpoint that was first
+	tied int
+	// Differences with the other source in milliseconds (other - endpoint)
+	differences []float64
+	// How far this endpoint lagged behind the fastest endpoint in milliseconds
+	lags []float64
+}
+
+// mergeObservations merges the observation streams of all endpoint sources into a single stream.
+// Observations are tagged with their endpoint by the source itself. Every endpoint source whose stream ends
+// before the context is canceled is sent on the closed channel, and the merged stream is closed once all
+// endpoint streams are.
+func mergeObservations(ctx context.Context, sources []*fiber.FiberSource) (chan types.Observation, chan *fiber.FiberSource, error) {
+	merged := make(chan types.Observation, types.OBSERVATION_BUFFER_SIZE)
+	closed := make(chan *fiber.FiberSource, len(sources))
+
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		ch, err := source.SubscribeTransactionObservations(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("subscribing to %s: %w", source.Endpoint(), err)
+		}
+
+		wg.Add(1)
+		go func(source *fiber.FiberSource, ch chan types.Observation) {
+			defer wg.Done()
+
+			for obs := range ch {
+				select {
+				case merged <- obs:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if ctx.Err() == nil {
+				closed <- source
+			}
+		}(source, ch)
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	return merged, closed, nil
+}
+
+// recordEndpointObservation records the first observation per endpoint and counts repeats, and keeps the earliest observation
+// across all endpoints in fiberMap, which is what the multiplexer would have delivered.
+func (b *TransactionBenchmarker) recordEndpointObservation(obs types.Observation, fiberMap map[common.Hash]types.Observation, endpointMaps map[string]map[common.Hash]types.Observation, endpointDups map[string]*duplicates) {
+	if endpointDups[obs.Source].observe(obs.Hash, obs.WireTimestamp) {
+		return
+	}
+
+	endpointMaps[obs.Source][obs.Hash] = obs
+
+	if first, ok := fiberMap[obs.Hash]; !ok || obs.WireTimestamp < first.WireTimestamp {
+		fiberMap[obs.Hash] = obs
+	}
+}
+
+// processEndpointResults attributes every confirmed transaction to the endpoint that saw it first, and reports
+// per-endpoint latency and the marginal benefit of multiplexing over the best single endpoint.
+func (b *TransactionBenchmarker) processEndpointResults(endpointMaps map[string]map[common.Hash]types.Observation, otherMap map[common.Hash]types.Observation, truthMap map[common.Hash]types.Inclusion) {
+	results := make(map[string]*endpointResult, len(endpointMaps))
+	for endpoint := range endpointMaps {
+		results[endpoint] = new(endpointResult)
+	}
+
+	multiplexSeen := 0
+
+	for hash := range truthMap {
+		winner := ""
+		first := int64(0)
+
+		for _, endpoint := range b.config.fiberConfig().Endpoints {
+			obs, ok := endpointMaps[endpoint][hash]
+			if !ok {
+				continue
+			}
+
+			if winner == "" || obs.WireTimestamp < first {
+				winner = endpoint
+				first = obs.WireTimestamp
+			}
+		}
+
+		if winner == "" {
+			continue
+		}
+
+		multiplexSeen++
+
+		otherObs, otherSaw := otherMap[hash]
+		var leaders []*endpointResult
+
+		for endpoint, result := range results {
+			obs, ok := endpointMaps[endpoint][hash]
+			if !ok {
+				continue
+			}
+
+			lag := float64(obs.WireTimestamp-first) / 1000
+			if lag <= b.config.deadBand() {
+				leaders = append(leaders, result)
+			}
+
+			result.seen++
+			result.lags = append(result.lags, lag)
+
+			if otherSaw {
+				result.differences = append(result.differences, float64(otherObs.Timestamp-obs.Timestamp)/1000)
+			}
+		}
+
+		if len(leaders) == 1 {
+			leaders[0].won++
+		} else {
+			for _, result := range leaders {
+				result.tied++
+			}
+		}
+	}
+
+	if multiplexSeen == 0 {
+		b.logger.Warn().Msg("No confirmed transactions seen by any Fiber endpoint")
+		return
+	}
+
+	var (
+		best    string
+		bestLag float64
+	)
+
+	for _, endpoint := range b.config.fiberConfig().Endpoints {
+		result := results[endpoint]
+		if result.seen == 0 {
+			b.logger.Warn().Str("endpoint", endpoint).Msg("Endpoint saw no confirmed transactions")
+			continue
+		}
+
+		meanLag, _ := stats.Mean(result.lags)
+		meanDiff, _ := stats.Mean(result.differences)
+		medianDiff, _ := stats.Median(result.differences)
+		won, lost, tied := types.CountOutcomes(result.differences, b.config.deadBand()).Ratios()
+
+		b.logger.Info().Str("endpoint", endpoint).Msg(fmt.Sprintf("Won: %.2f%% | Tied: %.2f%% | Coverage: %.2f%% | Mean lag: %.4fms", float64(result.won)/float64(multiplexSeen)*100, float64(result.tied)/float64(multiplexSeen)*100, float64(result.seen)/float64(multiplexSeen)*100, meanLag))
+		if len(result.differences) > 0 {
+			b.logger.Info().Str("endpoint", endpoint).Msg(fmt.Sprintf("vs. %s mean: %.4fms | median: %.4fms | won: %.2f%% | lost: %.2f%% | tied: %.2f%%", b.otherSourceName, meanDiff, medianDiff, won*100, lost*100, tied*100))
+		}
+
+		if best == "" || meanLag < bestLag || (meanLag == bestLag && result.seen > results[best].seen) {
+			best = endpoint
+			bestLag = meanLag
+		}
+	}
+
+	if best == "" {
+		return
+	}
+
+	// The multiplexed stream is the earliest observation across all endpoints, so the lag of the best
+	// single endpoint is exactly what multiplexing gains on top of it.
+	b.logger.Info().Str("endpoint", best).Msg(fmt.Sprintf("Best single endpoint, multiplexing gains %.4fms on average and %d extra transactions", bestLag, multiplexSeen-results[best].seen))
+}
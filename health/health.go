@@ -0,0 +1,275 @@
+package health
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+const (
+	gcPausesMetric       = "/gc/pauses:seconds"
+	schedLatenciesMetric = "/sched/latencies:seconds"
+)
+
+// Thresholds above which an interval is considered tainted, i.e. the benchmarker itself
+// might have distorted the results.
+type Thresholds struct {
+	// Fraction of a channel's capacity
+	BufferOccupancy float64
+	GCPause         time.Duration
+	SchedLatency    time.Duration
+}
+
+// Report describes the health of the benchmarker over a single interval.
+type Report struct {
+	// Maximum observed occupancy per channel, as a fraction of its capacity
+	MaxBufferOccupancy map[string]float64
+	// Number of samples per channel in which the channel was full, which means the producer was blocked
+	BlockingEvents map[string]int
+	// Longest GC stop-the-world pause
+	GCPauseMax time.Duration
+	// 99th percentile and maximum time goroutines spent runnable before running
+	SchedLatencyP99 time.Duration
+	SchedLatencyMax time.Duration
+
+	Tainted bool
+	// Why the interval is tainted
+	Reasons []string
+}
+
+// MaxOccupancy returns the maximum occupancy over all channels.
+func (r Report) MaxOccupancy() float64 {
+	max := 0.0
+	for _, occupancy := range r.MaxBufferOccupancy {
+		max = math.Max(max, occupancy)
+	}
+
+	return max
+}
+
+// TotalBlockingEvents returns the number of blocking events over all channels.
+func (r Report) TotalBlockingEvents() int {
+	total := 0
+	for _, events := range r.BlockingEvents {
+		total += events
+	}
+
+	return total
+}
+
+type channel struct {
+	name     string
+	len      func() int
+	capacity int
+}
+
+// Monitor samples the occupancy of channels and the Go runtime metrics in the background.
+type Monitor struct {
+	sampleInterval time.Duration
+	thresholds     Thresholds
+
+	mu           sync.Mutex
+	channels     []channel
+	maxOccupancy map[string]float64
+	blocking     map[string]int
+
+	// Runtime histograms at the start of the interval
+	gcPauses       *metrics.Float64Histogram
+	schedLatencies *metrics.Float64Histogram
+
+	done chan struct{}
+}
+
+func NewMonitor(sampleInterval time.Duration, thresholds Thresholds) *Monitor {
+	m := &Monitor{
+		sampleInterval: sampleInterval,
+		thresholds:     thresholds,
+		maxOccupancy:   make(map[string]float64),
+		blocking:       make(map[string]int),
+		done:           make(chan struct{}),
+	}
+
+	m.gcPauses, m.schedLatencies = readHistograms()
+
+	return m
+}
+
+// Watch adds a channel to be sampled. A channel watched under the same name before, e.g. the stream of a source
+// that was resubscribed, is replaced. Unbuffered channels are ignored, since they have no occupancy.
+func Watch[T any](m *Monitor, name string, ch chan T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.channels {
+		if m.channels[i].name == name {
+			m.channels = append(m.channels[:i], m.channels[i+1:]...)
+			break
+		}
+	}
+
+	if cap(ch) == 0 {
+		return
+	}
+
+	m.channels = append(m.channels, channel{
+		name:     name,
+		len:      func() int { return len(ch) },
+		capacity: cap(ch),
+	})
+}
+
+// Start starts sampling in the background until Stop is called.
+func (m *Monitor) Start() {
+	go func() {
+		ticker := time.NewTicker(m.sampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				m.sample()
+			}
+		}
+	}()
+}
+
+func (m *Monitor) Stop() {
+	close(m.done)
+}
+
+func (m *Monitor) sample() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ch := range m.channels {
+		n := ch.len()
+		occupancy := float64(n) / float64(ch.capacity)
+
+		if occupancy > m.maxOccupancy[ch.name] {
+			m.maxOccupancy[ch.name] = occupancy
+		}
+
+		if n >= ch.capacity {
+			m.blocking[ch.name]++
+		}
+	}
+}
+
+// Collect returns the report since the previous call (or since the monitor was created), and starts a new interval.
+func (m *Monitor) Collect() Report {
+	m.sample()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gcPauses, schedLatencies := readHistograms()
+	gcDelta := delta(m.gcPauses, gcPauses)
+	schedDelta := delta(m.schedLatencies, schedLatencies)
+	m.gcPauses, m.schedLatencies = gcPauses, schedLatencies
+
+	report := Report{
+		MaxBufferOccupancy: m.maxOccupancy,
+		BlockingEvents:     m.blocking,
+		GCPauseMax:         quantile(gcDelta, 1),
+		SchedLatencyP99:    quantile(schedDelta, 0.99),
+		SchedLatencyMax:    quantile(schedDelta, 1),
+	}
+
+	m.maxOccupancy = make(map[string]float64)
+	m.blocking = make(map[string]int)
+
+	for _, ch := range m.channels {
+		if occupancy := report.MaxBufferOccupancy[ch.name]; occupancy >= m.thresholds.BufferOccupancy {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("%s buffer occupancy reached %.0f%%", ch.name, occupancy*100))
+		}
+
+		if events := report.BlockingEvents[ch.name]; events > 0 {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("%s buffer was full in %d samples", ch.name, events))
+		}
+	}
+
+	if report.GCPauseMax >= m.thresholds.GCPause {
+		report.Reasons = append(report.Reasons, fmt.Sprintf("GC pause of %s", report.GCPauseMax))
+	}
+
+	if report.SchedLatencyP99 >= m.thresholds.SchedLatency {
+		report.Reasons = append(report.Reasons, fmt.Sprintf("p99 scheduling latency of %s", report.SchedLatencyP99))
+	}
+
+	report.Tainted = len(report.Reasons) > 0
+
+	return report
+}
+
+func readHistograms() (*metrics.Float64Histogram, *metrics.Float64Histogram) {
+	samples := []metrics.Sample{{Name: gcPausesMetric}, {Name: schedLatenciesMetric}}
+	metrics.Read(samples)
+
+	return histogram(samples[0]), histogram(samples[1])
+}
+
+// histogram returns the histogram of the sample, or nil if the metric isn't supported by this runtime.
+func histogram(sample metrics.Sample) *metrics.Float64Histogram {
+	if sample.Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+
+	return sample.Value.Float64Histogram()
+}
+
+// delta returns the histogram of everything that was recorded between the two cumulative histograms.
+func delta(prev, curr *metrics.Float64Histogram) *metrics.Float64Histogram {
+	if curr == nil {
+		return nil
+	}
+
+	counts := make([]uint64, len(curr.Counts))
+	for i := range curr.Counts {
+		counts[i] = curr.Counts[i]
+		if prev != nil && i < len(prev.Counts) {
+			counts[i] -= prev.Counts[i]
+		}
+	}
+
+	return &metrics.Float64Histogram{Counts: counts, Buckets: curr.Buckets}
+}
+
+// quantile returns an upper bound of the q-quantile (in [0, 1]) of a histogram in seconds.
+func quantile(h *metrics.Float64Histogram, q float64) time.Duration {
+	if h == nil {
+		return 0
+	}
+
+	total := uint64(0)
+	for _, count := range h.Counts {
+		total += count
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(q * float64(total)))
+	cumulative := uint64(0)
+
+	for i, count := range h.Counts {
+		cumulative += count
+		if cumulative < target || count == 0 {
+			continue
+		}
+
+		// Use the upper bound of the bucket, unless it's unbounded
+		bound := h.Buckets[i+1]
+		if math.IsInf(bound, 1) {
+			bound = h.Buckets[i]
+		}
+
+		return time.Duration(bound * float64(time.Second))
+	}
+
+	return 0
+}
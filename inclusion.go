@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/montanaflynn/stats"
+	"github.com/rs/zerolog"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// leadTimes collects how long before inclusion a source saw confirmed transactions, in milliseconds.
+type leadTimes struct {
+	// Until the execution payload with the transaction arrived
+	payload []float64
+	// Until the start of the slot the transaction was included in. Negative if the transaction was
+	// seen during the slot.
+	slot []float64
+}
+
+func (l *leadTimes) add(timestamp int64, inclusion types.Inclusion) {
+	l.payload = append(l.payload, float64(inclusion.PayloadTimestamp-timestamp)/1000)
+	l.slot = append(l.slot, float64(inclusion.SlotTimestamp-timestamp)/1000)
+}
+
+// medians returns the median payload and slot lead times.
+func (l *leadTimes) medians() (float64, float64) {
+	payload, _ := stats.Median(l.payload)
+	slot, _ := stats.Median(l.slot)
+	return payload, slot
+}
+
+func (l *leadTimes) print(logger zerolog.Logger, source string) {
+	if len(l.payload) == 0 {
+		return
+	}
+
+	payloadP10, _ := stats.Percentile(l.payload, 10)
+	payloadP50, _ := stats.Percentile(l.payload, 50)
+	slotP10, _ := stats.Percentile(l.slot, 10)
+	slotP50, _ := stats.Percentile(l.slot, 50)
+
+	logger.Info().Str("source", source).Msg(fmt.Sprintf("Lead time before payload p10: %.1fms | p50: %.1fms, before slot start p10: %.1fms | p50: %.1fms", payloadP10, payloadP50, slotP10, slotP50))
+}
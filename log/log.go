@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -10,9 +11,26 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Console is where logs and other output for humans go: stdout, or stderr after UseStderr was called.
+var Console io.Writer = console{}
+
+var consoleOut io.Writer = os.Stdout
+
+type console struct{}
+
+func (console) Write(p []byte) (int, error) {
+	return consoleOut.Write(p)
+}
+
+// UseStderr sends the console output to stderr, so stdout only contains data (e.g. JSONL rows). Loggers that
+// were created before follow along. Must be called before anything runs in the background.
+func UseStderr() {
+	consoleOut = os.Stderr
+}
+
 func NewLogger(module string) zerolog.Logger {
 	zerolog.TimeFieldFormat = time.RFC3339Nano
-	output := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "15:04:05.000"}
+	output := zerolog.ConsoleWriter{Out: Console, TimeFormat: "15:04:05.000"}
 	output.FormatMessage = func(i interface{}) string {
 		return fmt.Sprintf("%-45s", fmt.Sprintf("[%s] %s", strings.ToUpper(module), i))
 	}
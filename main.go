@@ -1,54 +1,168 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/montanaflynn/stats"
+	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 
+	"github.com/chainbound/fiber-benchmarks/compare"
+	"github.com/chainbound/fiber-benchmarks/health"
 	"github.com/chainbound/fiber-benchmarks/log"
 	"github.com/chainbound/fiber-benchmarks/sinks"
+	"github.com/chainbound/fiber-benchmarks/sinks/async"
 	"github.com/chainbound/fiber-benchmarks/sinks/clickhouse"
 	"github.com/chainbound/fiber-benchmarks/sinks/csv"
+	"github.com/chainbound/fiber-benchmarks/sinks/fanout"
+	"github.com/chainbound/fiber-benchmarks/sinks/jsonl"
+	"github.com/chainbound/fiber-benchmarks/sources"
+	"github.com/chainbound/fiber-benchmarks/sources/fiber"
+	"github.com/chainbound/fiber-benchmarks/sources/jsonrpc"
 	"github.com/chainbound/fiber-benchmarks/types"
-)
 
-type Sink interface {
-	RecordBlockObservationRow(result *types.BlockObservationRow) error
-	RecordObservationRow(result *types.ConfirmedObservationRow) error
-	RecordStats(stats *types.ObservationStatsRow) error
-	RecordBlockStats(stats *types.ObservationStatsRow) error
-	Flush() error
-}
+	// Register the source types
+	_ "github.com/chainbound/fiber-benchmarks/sources/bloxroute"
+	_ "github.com/chainbound/fiber-benchmarks/sources/devp2p"
+)
 
 type config struct {
-	fiberEndpoints []string
-	endpointSlice  cli.StringSlice
-	fiberKey       string
-	blxrEndpoint   string
-	blxrKey        string
+	// Registry configs of the sources in use by type, from the config file and the source flags
+	sourceConfigs map[string]sources.Config
+	// Type of the source that Fiber is compared against, empty if there is none. Defaults to the only
+	// configured source other than Fiber.
+	otherSource string
+	perEndpoint bool
+
+	// Source flags, which are mapped onto sourceConfigs by applySourceFlags
+	endpointSlice   cli.StringSlice
+	fiberKey        string
+	blxrEndpoint    string
+	blxrKey         string
+	blxrTransport   string
+	blxrInsecure    bool
+	jsonrpcName     string
+	jsonrpcEndpoint string
+	jsonrpcMethod   string
+	// Subscription params of the JSON-RPC source as a JSON array
+	jsonrpcParams        string
+	jsonrpcFetchEndpoint string
+	devp2pPeerSlice      cli.StringSlice
+	devp2pKey            string
 
 	crossCheck    bool
 	interval      time.Duration
 	intervalCount int
 	logMissing    bool
 	logFile       string
-	sink          string
+	sinks         []string
+	sinkSlice     cli.StringSlice
+	sinkQueueSize int
+	sinkOverflow  string
 	benchmarkID   string
+	// Region the benchmark runs in, recorded in the run metadata
+	region string
 
 	clickhouse clickhouse.ClickhouseConfig
+	jsonl      jsonl.Config
+	// Rotation size of the JSONL file in megabytes
+	jsonlMaxSize int
+
+	healthSampleInterval time.Duration
+	healthThresholds     health.Thresholds
+
+	// Differences within this are counted as ties
+	tieThreshold time.Duration
+	// Observations are discarded for this long before the first interval
+	warmup time.Duration
+	// Differences larger than this in either direction are discarded as outliers. Disabled if 0.
+	maxAbsDiff time.Duration
+
+	histogram      types.HistogramConfig
+	histogramScale string
+	histogramView  string
+
+	configFile string
+	profile    string
+	// Parsed config file, if any
+	file *fileConfig
 }
 
 func (c *config) validate() error {
-	if c.sink != "none" && c.sink != "stdout" && c.sink != "clickhouse" && c.sink != "csv" {
-		return fmt.Errorf("invalid sink: %s", c.sink)
+	if c.file != nil {
+		if err := c.file.validate(); err != nil {
+			return fmt.Errorf("config file: %w", err)
+		}
+	}
+
+	if c.benchmarkID == "" {
+		return fmt.Errorf("benchmark ID is required")
+	}
+
+	if c.fiberConfig().Key == "" {
+		return fmt.Errorf("fiber key is required")
+	}
+
+	if c.interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	if _, err := sources.New(c.fiberConfig()); err != nil {
+		return err
+	}
+
+	if err := c.validateOtherSource(); err != nil {
+		return err
+	}
+
+	for _, sink := range c.sinks {
+		if sink != "none" && sink != "stdout" && sink != "clickhouse" && sink != "csv" && sink != "jsonl" {
+			return fmt.Errorf("invalid sink: %s", sink)
+		}
+	}
+
+	if c.tieThreshold < 0 {
+		return fmt.Errorf("tie threshold can't be negative")
+	}
+
+	if c.warmup < 0 {
+		return fmt.Errorf("warm-up can't be negative")
+	}
+
+	if c.maxAbsDiff < 0 {
+		return fmt.Errorf("max absolute difference can't be negative")
+	}
+
+	if c.healthSampleInterval <= 0 {
+		return fmt.Errorf("health sample interval must be positive")
+	}
+
+	if c.sinkQueueSize < 1 {
+		return fmt.Errorf("sink queue size must be at least 1")
+	}
+
+	if _, err := async.ParseOverflowPolicy(c.sinkOverflow); err != nil {
+		return err
+	}
+
+	if err := c.histogram.Validate(); err != nil {
+		return err
 	}
 
-	c.fiberEndpoints = append(c.fiberEndpoints, c.endpointSlice.Value()...)
+	if c.perEndpoint && len(c.fiberConfig().Endpoints) < 2 {
+		return fmt.Errorf("per-endpoint mode requires at least 2 fiber endpoints")
+	}
 
-	if c.sink == "clickhouse" {
+	if c.hasSink("clickhouse") {
 		if c.clickhouse.Endpoint == "" {
 			return fmt.Errorf("clickhouse endpoint is required")
 		}
@@ -64,27 +178,203 @@ func (c *config) validate() error {
 		if c.clickhouse.DB == "" {
 			return fmt.Errorf("clickhouse database is required")
 		}
+
+		if c.clickhouse.MaxRetries < 1 {
+			return fmt.Errorf("clickhouse max retries must be at least 1")
+		}
+
+		if c.clickhouse.ObservationsTTL < 0 || c.clickhouse.StatsTTL < 0 {
+			return fmt.Errorf("clickhouse TTLs can't be negative")
+		}
 	}
 
-	if c.sink == "csv" {
+	if c.hasSink("csv") {
 		if c.logFile == "" {
 			return fmt.Errorf("log file is required for CSV sink")
 		}
 	}
 
+	if c.hasSink("jsonl") {
+		if c.jsonl.File == "" {
+			return fmt.Errorf("JSONL file is required for JSONL sink")
+		}
+
+		if c.jsonlMaxSize < 0 || c.jsonl.RotateInterval < 0 {
+			return fmt.Errorf("JSONL rotation size and interval can't be negative")
+		}
+	}
+
 	return nil
 }
 
-type TransactionSource interface {
-	SubscribeTransactionObservations() chan types.Observation
+// validateOtherSource checks the configuration of the source that Fiber is compared against. Factories don't
+// connect, so instantiating the source is enough.
+func (c *config) validateOtherSource() error {
+	if c.otherSource == "" {
+		return nil
+	}
+
+	_, err := sources.New(c.otherSourceConfig())
+	return err
+}
+
+// hasSink returns true if the given sink type is one of the configured sinks.
+func (c *config) hasSink(sink string) bool {
+	for _, s := range c.sinks {
+		if s == sink {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fiberConfig returns the registry config of Fiber.
+func (c *config) fiberConfig() sources.Config {
+	config := c.sourceConfigs["fiber"]
+	config.Type = "fiber"
+	return config
+}
+
+// otherSourceConfig returns the registry config of the source that Fiber is compared against.
+func (c *config) otherSourceConfig() sources.Config {
+	return c.sourceConfigs[c.otherSource]
 }
 
-type BlockSource interface {
-	SubscribeBlockObservations() chan types.BlockObservation
+// applySourceFlags maps the source flags that are set onto the registry configs of their types, overriding
+// the config file. It only exists for compatibility: new source types are configured in the config file.
+func (c *config) applySourceFlags(ctx *cli.Context) error {
+	var params []any
+	if c.jsonrpcParams != "" {
+		if err := json.Unmarshal([]byte(c.jsonrpcParams), &params); err != nil {
+			return fmt.Errorf("invalid JSON-RPC params: %w", err)
+		}
+	}
+
+	for typ, flags := range map[string]map[string]func(*sources.Config){
+		"fiber": {
+			"fiber-endpoint": func(s *sources.Config) { s.Endpoints = c.endpointSlice.Value() },
+			"fiber-key":      func(s *sources.Config) { s.Key = c.fiberKey },
+		},
+		"bloxroute": {
+			"blxr-endpoint":  func(s *sources.Config) { s.Endpoints = []string{c.blxrEndpoint} },
+			"blxr-key":       func(s *sources.Config) { s.Key = c.blxrKey },
+			"blxr-transport": func(s *sources.Config) { setOption(s, "transport", c.blxrTransport) },
+			"blxr-insecure":  func(s *sources.Config) { setOption(s, "insecure", c.blxrInsecure) },
+		},
+		"jsonrpc": {
+			"jsonrpc-name":           func(s *sources.Config) { s.Name = c.jsonrpcName },
+			"jsonrpc-endpoint":       func(s *sources.Config) { s.Endpoints = []string{c.jsonrpcEndpoint} },
+			"jsonrpc-method":         func(s *sources.Config) { setOption(s, "method", c.jsonrpcMethod) },
+			"jsonrpc-params":         func(s *sources.Config) { setOption(s, "params", params) },
+			"jsonrpc-fetch-endpoint": func(s *sources.Config) { setOption(s, "fetch-endpoint", c.jsonrpcFetchEndpoint) },
+		},
+		"devp2p": {
+			"devp2p-peer": func(s *sources.Config) { s.Endpoints = c.devp2pPeerSlice.Value() },
+			"devp2p-key":  func(s *sources.Config) { s.Key = c.devp2pKey },
+		},
+	} {
+		source, ok := c.sourceConfigs[typ]
+		for flag, apply := range flags {
+			if ctx.IsSet(flag) {
+				apply(&source)
+				ok = true
+			}
+		}
+
+		if ok {
+			source.Type = typ
+			c.sourceConfigs[typ] = source
+		}
+	}
+
+	return nil
+}
+
+// setOption sets an option of the source.
+func setOption(source *sources.Config, key string, value any) {
+	if source.Options == nil {
+		source.Options = make(map[string]any)
+	}
+
+	source.Options[key] = value
+}
+
+// selectOtherSource checks the source that Fiber is compared against, or picks the only other source if none
+// was given.
+func (c *config) selectOtherSource() error {
+	if c.otherSource != "" {
+		if _, ok := c.sourceConfigs[c.otherSource]; !ok || c.otherSource == "fiber" {
+			return fmt.Errorf("invalid other source: %s", c.otherSource)
+		}
+
+		return nil
+	}
+
+	var others []string
+	for typ := range c.sourceConfigs {
+		if typ != "fiber" {
+			others = append(others, typ)
+		}
+	}
+	sort.Strings(others)
+
+	switch len(others) {
+	case 0:
+	case 1:
+		c.otherSource = others[0]
+	default:
+		return fmt.Errorf("sources %s are configured, pick the one to compare Fiber against with --other-source", strings.Join(others, ", "))
+	}
+
+	return nil
+}
+
+// deadBand returns the tie threshold in milliseconds, the unit of the differences.
+func (c *config) deadBand() float64 {
+	return float64(c.tieThreshold) / float64(time.Millisecond)
+}
+
+// isOutlier returns true if the difference in microseconds exceeds the maximum absolute difference.
+func (c *config) isOutlier(diff int64) bool {
+	if c.maxAbsDiff == 0 {
+		return false
+	}
+
+	return diff > c.maxAbsDiff.Microseconds() || -diff > c.maxAbsDiff.Microseconds()
+}
+
+// newFiberSource instantiates Fiber from its registry config.
+func newFiberSource(config *config) (*fiber.FiberSource, error) {
+	source, err := sources.New(config.fiberConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	fiberSource, ok := source.(*fiber.FiberSource)
+	if !ok {
+		return nil, fmt.Errorf("source %s is not a Fiber source", source.Name())
+	}
+
+	return fiberSource, nil
+}
+
+// newOtherSource instantiates the source that Fiber is compared against, or returns nil if there is none.
+func newOtherSource(config *config) (sources.Source, error) {
+	if config.otherSource == "" {
+		return nil, nil
+	}
+
+	return sources.New(config.otherSourceConfig())
 }
 
 func main() {
 	var config config
+	var reportFrom, reportOutput string
+	var baseline, candidate string
+	var thresholds compare.Thresholds
+	var send sendConfig
+	var dryRun bool
 
 	log := log.NewLogger("benchmark")
 
@@ -110,7 +400,11 @@ func main() {
 					},
 				},
 				Action: func(c *cli.Context) error {
-					if err := runTransactionBenchmark(&config); err != nil {
+					if err := config.load(c); err != nil {
+						return err
+					}
+
+					if err := runTransactionBenchmark(c.Context, &config); err != nil {
 						return err
 					}
 
@@ -121,88 +415,487 @@ func main() {
 				Name:  "blocks",
 				Usage: "Benchmark block streams",
 				Action: func(c *cli.Context) error {
-					if err := runBlockBenchmark(&config); err != nil {
+					if err := config.load(c); err != nil {
+						return err
+					}
+
+					if err := runBlockBenchmark(c.Context, &config); err != nil {
 						return err
 					}
 					return nil
 				},
 			},
+			{
+				Name:  "send",
+				Usage: "Send self-transfers through Fiber, Bloxroute and an RPC node, and measure how long until each source streams them back and until inclusion",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:        "path",
+						Usage:       "Path to send through, can be repeated: 'fiber', 'bloxroute', 'rpc'. Default: all configured paths",
+						Destination: &send.paths,
+					},
+					&cli.StringFlag{
+						Name:        "rpc-endpoint",
+						Usage:       "RPC endpoint of a node, used for nonces, fees, inclusion and the 'rpc' path",
+						EnvVars:     []string{"SEND_RPC_ENDPOINT"},
+						Destination: &send.rpcEndpoint,
+					},
+					&cli.StringFlag{
+						Name:        "private-key",
+						Usage:       "Hex encoded private key of the sending account",
+						EnvVars:     []string{"SEND_PRIVATE_KEY"},
+						Destination: &send.privateKey,
+					},
+					&cli.Int64Flag{
+						Name:        "chain-id",
+						Usage:       "Chain ID to sign for. Default: the chain ID of the node",
+						Destination: &send.chainID,
+					},
+					&cli.IntFlag{
+						Name:        "count",
+						Usage:       "Number of transactions to send",
+						Value:       10,
+						Destination: &send.count,
+					},
+					&cli.DurationFlag{
+						Name:        "send-interval",
+						Usage:       "Time between transactions",
+						Value:       time.Second,
+						Destination: &send.interval,
+					},
+					&cli.DurationFlag{
+						Name:        "inclusion-timeout",
+						Usage:       "How long to wait for a transaction to be included before replacing it",
+						Value:       time.Minute,
+						Destination: &send.inclusionTimeout,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := config.load(c); err != nil {
+						return err
+					}
+
+					return runSendBenchmark(c.Context, &config, &send)
+				},
+			},
+			{
+				Name:  "report",
+				Usage: "Generate a self-contained HTML report of a finished transaction benchmark",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "from",
+						Usage:       "Where to read the benchmark from. Options: 'csv' (reads --log-file), 'clickhouse' (reads --benchmark-id)",
+						Value:       "csv",
+						Destination: &reportFrom,
+					},
+					&cli.StringFlag{
+						Name:        "output",
+						Usage:       "File to write the report to. Default: <benchmark-id>.html",
+						Destination: &reportOutput,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := config.load(c); err != nil {
+						return err
+					}
+
+					return writeReport(c.Context, &config, reportFrom, reportOutput)
+				},
+			},
+			{
+				Name:  "compare",
+				Usage: "Compare two finished transaction benchmarks and exit with an error on regressions",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "from",
+						Usage:       "Where to read the benchmarks from. Options: 'csv' (runs are log files), 'clickhouse' (runs are benchmark IDs)",
+						Value:       "csv",
+						Destination: &reportFrom,
+					},
+					&cli.StringFlag{
+						Name:        "baseline",
+						Usage:       "Run to compare against",
+						Required:    true,
+						Destination: &baseline,
+					},
+					&cli.StringFlag{
+						Name:        "candidate",
+						Usage:       "Run to compare",
+						Required:    true,
+						Destination: &candidate,
+					},
+					&cli.Float64Flag{
+						Name:        "max-percentile-regression",
+						Usage:       "Maximum significant decrease of any percentile of the difference in milliseconds",
+						Value:       1,
+						Destination: &thresholds.Percentile,
+					},
+					&cli.Float64Flag{
+						Name:        "max-win-ratio-regression",
+						Usage:       "Maximum significant decrease of the Fiber win ratio in percentage points",
+						Value:       2,
+						Destination: &thresholds.WinRatio,
+					},
+					&cli.Float64Flag{
+						Name:        "significance",
+						Usage:       "Changes with a p-value below this are significant",
+						Value:       0.05,
+						Destination: &thresholds.Alpha,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := config.load(c); err != nil {
+						return err
+					}
+
+					return compareRuns(c.Context, &config, reportFrom, baseline, candidate, thresholds)
+				},
+			},
+			{
+				Name:  "migrate",
+				Usage: "Migrate the Clickhouse schema to the latest version. Benchmarks also migrate it when they start",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "dry-run",
+						Usage:       "Print the statements of the pending migrations instead of applying them",
+						Destination: &dryRun,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := config.load(c); err != nil {
+						return err
+					}
+
+					return migrateClickhouse(c.Context, &config, dryRun)
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "Inspect the configuration",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "validate",
+						Usage: "Validate the config file, the selected profile and all flags",
+						Action: func(c *cli.Context) error {
+							if err := config.load(c); err != nil {
+								return err
+							}
+
+							if err := config.validate(); err != nil {
+								return err
+							}
+
+							log.Info().Str("profile", config.profile).Strs("fiber_endpoints", config.fiberConfig().Endpoints).Strs("sinks", config.sinks).Msg("Config is valid")
+							return nil
+						},
+					},
+				},
+			},
 		},
 		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "config",
+				Usage:       "YAML config file with sources, sinks, benchmark parameters and profiles. Flags and environment variables override its values.",
+				EnvVars:     []string{"BENCHMARK_CONFIG"},
+				Destination: &config.configFile,
+			},
+			&cli.StringFlag{
+				Name:        "profile",
+				Usage:       "Profile from the config file to use",
+				EnvVars:     []string{"BENCHMARK_PROFILE"},
+				Destination: &config.profile,
+			},
 			&cli.StringFlag{
 				Name:        "benchmark-id",
 				Usage:       "Unique ID for this benchmark. Used in the sink tables.",
-				Required:    true,
+				EnvVars:     []string{"BENCHMARK_ID"},
 				Destination: &config.benchmarkID,
 			},
+			&cli.StringFlag{
+				Name:        "region",
+				Usage:       "Region the benchmark runs in, e.g. eu-central-1. Recorded in the run metadata.",
+				EnvVars:     []string{"BENCHMARK_REGION"},
+				Destination: &config.region,
+			},
 			&cli.StringSliceFlag{
 				Name:        "fiber-endpoint",
 				Usage:       "Fiber API endpoints. If multiple are provided, the client multiplexer will be used.",
+				EnvVars:     []string{"FIBER_ENDPOINT"},
 				Destination: &config.endpointSlice,
-				Required:    true,
+			},
+			&cli.BoolFlag{
+				Name:        "fiber-per-endpoint",
+				Usage:       "Open a separate client per Fiber endpoint instead of multiplexing, and report which endpoint won each transaction.",
+				Destination: &config.perEndpoint,
 			},
 			&cli.StringFlag{
 				Name:        "fiber-key",
 				Usage:       "Fiber API key",
+				EnvVars:     []string{"FIBER_KEY"},
 				Destination: &config.fiberKey,
-				Required:    true,
 			},
 			&cli.StringFlag{
 				Name:        "blxr-endpoint",
 				Usage:       "Bloxroute API endpoint",
+				EnvVars:     []string{"BLXR_ENDPOINT"},
 				Destination: &config.blxrEndpoint,
 				Required:    false,
 			},
 			&cli.StringFlag{
 				Name:        "blxr-key",
 				Usage:       "Bloxroute API key",
+				EnvVars:     []string{"BLXR_KEY"},
 				Destination: &config.blxrKey,
 				Required:    false,
 			},
+			&cli.StringFlag{
+				Name:        "blxr-transport",
+				Usage:       "Bloxroute API transport: 'ws' for the websocket API, 'grpc' for the gRPC gateway API",
+				EnvVars:     []string{"BLXR_TRANSPORT"},
+				Value:       "ws",
+				Destination: &config.blxrTransport,
+			},
+			&cli.BoolFlag{
+				Name:        "blxr-insecure",
+				Usage:       "Connect to the Bloxroute gRPC gateway without TLS, e.g. for a local gateway",
+				EnvVars:     []string{"BLXR_INSECURE"},
+				Destination: &config.blxrInsecure,
+			},
+			&cli.StringFlag{
+				Name:        "other-source",
+				Usage:       "Type of the source to compare Fiber against, e.g. 'bloxroute', 'jsonrpc', 'devp2p'. Defaults to the only other configured source.",
+				EnvVars:     []string{"OTHER_SOURCE"},
+				Destination: &config.otherSource,
+			},
+			&cli.StringFlag{
+				Name:        "jsonrpc-name",
+				Usage:       "Name of the JSON-RPC source in logs and stats",
+				EnvVars:     []string{"JSONRPC_NAME"},
+				Value:       jsonrpc.DefaultName,
+				Destination: &config.jsonrpcName,
+			},
+			&cli.StringFlag{
+				Name:        "jsonrpc-endpoint",
+				Usage:       "JSON-RPC websocket endpoint of a mempool provider",
+				EnvVars:     []string{"JSONRPC_ENDPOINT"},
+				Destination: &config.jsonrpcEndpoint,
+			},
+			&cli.StringFlag{
+				Name:        "jsonrpc-method",
+				Usage:       "JSON-RPC subscription method",
+				EnvVars:     []string{"JSONRPC_METHOD"},
+				Value:       jsonrpc.DefaultMethod,
+				Destination: &config.jsonrpcMethod,
+			},
+			&cli.StringFlag{
+				Name:        "jsonrpc-params",
+				Usage:       `JSON-RPC subscription params as a JSON array (default: ["newPendingTransactions"])`,
+				EnvVars:     []string{"JSONRPC_PARAMS"},
+				Destination: &config.jsonrpcParams,
+			},
+			&cli.StringFlag{
+				Name:        "jsonrpc-fetch-endpoint",
+				Usage:       "JSON-RPC endpoint to fetch transactions from if only hashes are pushed (default: the JSON-RPC endpoint)",
+				EnvVars:     []string{"JSONRPC_FETCH_ENDPOINT"},
+				Destination: &config.jsonrpcFetchEndpoint,
+			},
+			&cli.StringSliceFlag{
+				Name:        "devp2p-peer",
+				Usage:       "Enode URL of a peer to connect to on the Ethereum p2p network, can be repeated",
+				EnvVars:     []string{"DEVP2P_PEERS"},
+				Destination: &config.devp2pPeerSlice,
+			},
+			&cli.StringFlag{
+				Name:        "devp2p-key",
+				Usage:       "Hex encoded node key of the devp2p source (default: a new key)",
+				EnvVars:     []string{"DEVP2P_KEY"},
+				Destination: &config.devp2pKey,
+			},
 			&cli.DurationFlag{
 				Name:        "interval",
 				Usage:       "Duration of each interval",
-				Required:    true,
+				EnvVars:     []string{"BENCHMARK_INTERVAL"},
 				Destination: &config.interval,
 			},
 			&cli.IntFlag{
 				Name:        "interval-count",
 				Usage:       "Number of intervals to run",
+				EnvVars:     []string{"BENCHMARK_INTERVAL_COUNT"},
 				Value:       1,
 				Destination: &config.intervalCount,
 			},
 			&cli.StringFlag{
 				Name:        "log-file",
 				Usage:       "File to save detailed logs in case of file sink",
+				EnvVars:     []string{"BENCHMARK_LOG_FILE"},
 				Destination: &config.logFile,
 			},
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:        "sink",
-				Usage:       "Output sink. Options: 'clickhouse', 'svg', 'stdout', 'none'. Default: 'none'",
-				Value:       "none",
-				Destination: &config.sink,
+				Usage:       "Output sinks. Can be repeated to write to multiple sinks at once. Options: 'clickhouse', 'csv', 'jsonl', 'stdout', 'none'. Default: 'none'",
+				EnvVars:     []string{"BENCHMARK_SINK"},
+				Destination: &config.sinkSlice,
+			},
+			&cli.DurationFlag{
+				Name:        "health-sample-interval",
+				Usage:       "How often to sample the occupancy of the observation buffers",
+				Value:       10 * time.Millisecond,
+				Destination: &config.healthSampleInterval,
+			},
+			&cli.Float64Flag{
+				Name:        "taint-buffer-occupancy",
+				Usage:       "Mark an interval as tainted if an observation buffer reaches this fraction of its capacity",
+				Value:       0.5,
+				Destination: &config.healthThresholds.BufferOccupancy,
+			},
+			&cli.DurationFlag{
+				Name:        "taint-gc-pause",
+				Usage:       "Mark an interval as tainted if a GC pause takes at least this long",
+				Value:       10 * time.Millisecond,
+				Destination: &config.healthThresholds.GCPause,
+			},
+			&cli.DurationFlag{
+				Name:        "taint-sched-latency",
+				Usage:       "Mark an interval as tainted if the p99 goroutine scheduling latency reaches this",
+				Value:       5 * time.Millisecond,
+				Destination: &config.healthThresholds.SchedLatency,
+			},
+			&cli.DurationFlag{
+				Name:        "tie-threshold",
+				Usage:       "Differences of at most this in either direction are counted as ties instead of wins, e.g. 100µs",
+				EnvVars:     []string{"BENCHMARK_TIE_THRESHOLD"},
+				Destination: &config.tieThreshold,
+			},
+			&cli.DurationFlag{
+				Name:        "warmup",
+				Usage:       "Discard observations for this long before the first interval, while connections warm up and stale buffers drain",
+				EnvVars:     []string{"BENCHMARK_WARMUP"},
+				Destination: &config.warmup,
+			},
+			&cli.DurationFlag{
+				Name:        "max-abs-diff",
+				Usage:       "Discard differences larger than this in either direction as outliers, e.g. replays or resubmissions. Disabled if 0.",
+				EnvVars:     []string{"BENCHMARK_MAX_ABS_DIFF"},
+				Destination: &config.maxAbsDiff,
+			},
+			&cli.StringFlag{
+				Name:        "histogram-scale",
+				Usage:       "Scale of the terminal histogram. Options: 'auto' (round bins between the 1st and 99th percentile), 'linear', 'log' (mirrored around 0 if the range contains it)",
+				Value:       "auto",
+				Destination: &config.histogramScale,
+			},
+			&cli.StringFlag{
+				Name:        "histogram-view",
+				Usage:       "How to print the terminal histogram. Options: 'bars', 'cdf', 'sparkline'",
+				Value:       "bars",
+				Destination: &config.histogramView,
+			},
+			&cli.IntFlag{
+				Name:        "histogram-bins",
+				Usage:       "Number of histogram bins, excluding the 2 open-ended bins for values out of range",
+				Value:       20,
+				Destination: &config.histogram.Bins,
+			},
+			&cli.Float64Flag{
+				Name:        "histogram-min",
+				Usage:       "Lower bound of the histogram bins in milliseconds. Ignored by the auto scale.",
+				Value:       -10,
+				Destination: &config.histogram.Min,
+			},
+			&cli.Float64Flag{
+				Name:        "histogram-max",
+				Usage:       "Upper bound of the histogram bins in milliseconds. Ignored by the auto scale.",
+				Value:       10,
+				Destination: &config.histogram.Max,
+			},
+			&cli.IntFlag{
+				Name:        "sink-queue-size",
+				Usage:       "Number of records that can be queued for the sink writer",
+				Value:       65536,
+				Destination: &config.sinkQueueSize,
+			},
+			&cli.StringFlag{
+				Name:        "sink-overflow",
+				Usage:       "What to do with observations when the sink queue is full. Options: 'drop', 'block'. Stats and run metadata always block. Blocking can delay the next interval.",
+				Value:       "drop",
+				Destination: &config.sinkOverflow,
 			},
 			&cli.StringFlag{
 				Name:        "clickhouse-endpoint",
 				Usage:       "Clickhouse endpoint",
+				EnvVars:     []string{"CLICKHOUSE_ENDPOINT"},
 				Destination: &config.clickhouse.Endpoint,
 			},
 			&cli.StringFlag{
 				Name:        "clickhouse-user",
 				Usage:       "Clickhouse user",
+				EnvVars:     []string{"CLICKHOUSE_USER"},
 				Value:       "default",
 				Destination: &config.clickhouse.Username,
 			},
 			&cli.StringFlag{
 				Name:        "clickhouse-password",
 				Usage:       "Clickhouse password",
+				EnvVars:     []string{"CLICKHOUSE_PASSWORD"},
 				Destination: &config.clickhouse.Password,
 			},
 			&cli.StringFlag{
 				Name:        "clickhouse-db",
 				Usage:       "Clickhouse database",
+				EnvVars:     []string{"CLICKHOUSE_DB"},
 				Destination: &config.clickhouse.DB,
 			},
+			&cli.DurationFlag{
+				Name:        "clickhouse-timeout",
+				Usage:       "Timeout of a single Clickhouse operation",
+				Value:       10 * time.Second,
+				Destination: &config.clickhouse.Timeout,
+			},
+			&cli.IntFlag{
+				Name:        "clickhouse-max-retries",
+				Usage:       "Maximum number of attempts of a Clickhouse operation before giving up",
+				Value:       5,
+				Destination: &config.clickhouse.MaxRetries,
+			},
+			&cli.DurationFlag{
+				Name:        "clickhouse-backoff",
+				Usage:       "Backoff after the first failed Clickhouse attempt. Doubles after every attempt.",
+				Value:       500 * time.Millisecond,
+				Destination: &config.clickhouse.Backoff,
+			},
+			&cli.StringFlag{
+				Name:        "clickhouse-spill-file",
+				Usage:       "File to spill rows to when Clickhouse is unreachable. Spilled rows are replayed once it's back. Set to '' to drop them instead.",
+				Value:       "clickhouse.spill.jsonl",
+				Destination: &config.clickhouse.SpillFile,
+			},
+			&cli.DurationFlag{
+				Name:        "clickhouse-observations-ttl",
+				Usage:       "How long Clickhouse keeps observations, e.g. 720h. Default: forever",
+				Destination: &config.clickhouse.ObservationsTTL,
+			},
+			&cli.DurationFlag{
+				Name:        "clickhouse-stats-ttl",
+				Usage:       "How long Clickhouse keeps stats and per-minute quantiles, e.g. 8760h. Default: forever",
+				Destination: &config.clickhouse.StatsTTL,
+			},
+			&cli.StringFlag{
+				Name:        "jsonl-file",
+				Usage:       "File the JSONL sink writes to, or '-' for stdout",
+				EnvVars:     []string{"BENCHMARK_JSONL_FILE"},
+				Value:       "benchmarks.jsonl",
+				Destination: &config.jsonl.File,
+			},
+			&cli.IntFlag{
+				Name:        "jsonl-max-size",
+				Usage:       "Rotate the JSONL file once it reaches this many megabytes. Default: never",
+				Destination: &config.jsonlMaxSize,
+			},
+			&cli.DurationFlag{
+				Name:        "jsonl-rotate-interval",
+				Usage:       "Rotate the JSONL file after this long, e.g. 1h. Default: never",
+				Destination: &config.jsonl.RotateInterval,
+			},
 		},
 	}
 
@@ -211,46 +904,151 @@ func main() {
 	}
 }
 
-// TODO: Support other sinks
-func setupSink(config *config, ty sinks.InitType) (Sink, error) {
-	switch config.sink {
-	case "none":
-		return nil, nil
-	case "stdout":
-		return nil, nil
-	case "clickhouse":
-		c, err := clickhouse.NewClickhouseClient(&config.clickhouse)
-		if err != nil {
-			return nil, err
+// setupSink sets up all configured sinks behind a single fan-out sink, which is written to asynchronously.
+// Without any sinks configured, the fan-out sink simply discards everything.
+func setupSink(ctx context.Context, config *config, ty sinks.InitType) (sinks.Sink, error) {
+	fanoutSink := fanout.NewFanoutSink()
+
+	for _, sink := range config.sinks {
+		switch sink {
+		case "none":
+		case "stdout":
+		case "clickhouse":
+			c, err := clickhouse.NewClickhouseClient(&config.clickhouse)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.Init(ctx, ty); err != nil {
+				return nil, err
+			}
+
+			fanoutSink.Add(sink, c)
+		case "csv":
+			w, err := csv.NewCsvSink(config.logFile, ty)
+			if err != nil {
+				return nil, err
+			}
+
+			fanoutSink.Add(sink, w)
+		case "jsonl":
+			cfg := config.jsonl
+			cfg.MaxSize = int64(config.jsonlMaxSize) << 20
+
+			j, err := jsonl.NewJsonlSink(&cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			fanoutSink.Add(sink, j)
+		default:
+			return nil, fmt.Errorf("invalid sink: %s", sink)
 		}
-		if err := c.Init(ty); err != nil {
-			return nil, err
+	}
+
+	policy, err := async.ParseOverflowPolicy(config.sinkOverflow)
+	if err != nil {
+		return nil, err
+	}
+
+	return async.NewAsyncSink(fanoutSink, config.sinkQueueSize, policy), nil
+}
+
+// migrateClickhouse applies the pending migrations of the Clickhouse schema, or prints them with dryRun.
+func migrateClickhouse(ctx context.Context, config *config, dryRun bool) error {
+	if config.clickhouse.Endpoint == "" || config.clickhouse.DB == "" {
+		return fmt.Errorf("clickhouse endpoint and database are required")
+	}
+
+	c, err := clickhouse.NewClickhouseClient(&config.clickhouse)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.Migrate(ctx, dryRun)
+}
+
+// applyHealth records the health of the benchmarker during the interval in the stats, and warns if
+// the interval is tainted.
+func applyHealth(logger zerolog.Logger, stats *types.ObservationStatsRow, report health.Report) {
+	stats.Tainted = report.Tainted
+	stats.MaxBufferOccupancy = report.MaxOccupancy()
+	stats.BlockingEvents = int64(report.TotalBlockingEvents())
+	stats.GCPauseMax = float64(report.GCPauseMax.Microseconds()) / 1000
+	stats.SchedLatencyP99 = float64(report.SchedLatencyP99.Microseconds()) / 1000
+
+	if report.Tainted {
+		logger.Warn().Strs("reasons", report.Reasons).Msg("Interval tainted, benchmarker might have distorted the results")
+	}
+}
+
+// errStreamClosed is returned by benchmarks when a stream was closed before the benchmark was done.
+var errStreamClosed = errors.New("stream closed")
+
+// streamClosed returns the error for a stream of the source that was closed, with the last error of the source.
+func streamClosed(source sources.Source) error {
+	if err := source.Health().Err; err != nil {
+		return fmt.Errorf("%s: %w: %v", source.Name(), errStreamClosed, err)
+	}
+
+	return fmt.Errorf("%s: %w", source.Name(), errStreamClosed)
+}
+
+// interruptible returns a context that is canceled on the first interrupt or SIGTERM. After that, signals are
+// handled by the default handler again, so that a second interrupt exits right away instead of waiting for
+// the benchmark to shut down.
+func interruptible(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	return ctx, stop
+}
+
+// printSourceHealth reports the health of every source, and warns about sources that are disconnected.
+func printSourceHealth(logger zerolog.Logger, srcs ...sources.Source) {
+	for _, source := range srcs {
+		h := source.Health()
+		event := logger.Debug()
+		if !h.Connected {
+			event = logger.Warn()
 		}
 
-		return c, nil
-	case "csv":
-		w, err := csv.NewCsvSink(config.logFile, ty)
-		if err != nil {
-			return nil, err
+		if h.Err != nil {
+			event = event.AnErr("last_error", h.Err)
 		}
 
-		return w, nil
-	default:
-		return nil, fmt.Errorf("invalid sink: %s", config.sink)
+		event.Str("source", source.Name()).Bool("connected", h.Connected).Uint64("observations", h.Observations).Time("last_observation", h.LastObservation).Msg("Source health")
 	}
 }
 
-func buildBlockObservationStats(differences []float64) (types.ObservationStatsRow, error) {
-	fiberWon := float64(0)
-	blxrWon := float64(0)
+// printOutliers warns about observations that were discarded by the outlier rule.
+func printOutliers(logger zerolog.Logger, outliers int) {
+	if outliers > 0 {
+		logger.Warn().Int("outliers", outliers).Msg("Discarded outliers")
+	}
+}
 
-	for _, diff := range differences {
-		if diff > 0 {
-			fiberWon++
-		} else {
-			blxrWon++
-		}
+// printDecodeOverhead reports how long a source takes to decode its messages, which is the time between
+// the wire and decoded timestamps of its observations. Overheads are in microseconds.
+func printDecodeOverhead(logger zerolog.Logger, source string, overheads []float64) {
+	if len(overheads) == 0 {
+		return
 	}
+
+	mean, _ := stats.Mean(overheads)
+	p50, _ := stats.Percentile(overheads, 50)
+	p99, _ := stats.Percentile(overheads, 99)
+
+	logger.Info().Str("source", source).Msg(fmt.Sprintf("Decode overhead mean: %.1fµs | p50: %.1fµs | p99: %.1fµs", mean, p50, p99))
+}
+
+func buildBlockObservationStats(differences []float64, deadBand float64) (types.ObservationStatsRow, error) {
+	fiberWon, otherWon, tied := types.CountOutcomes(differences, deadBand).Ratios()
+
 	// Calculate all stats
 	mean, _ := stats.Mean(differences)
 	min, _ := stats.Min(differences)
@@ -270,24 +1068,18 @@ func buildBlockObservationStats(differences []float64) (types.ObservationStatsRo
 		P95:      p95,
 		Min:      min,
 		Max:      max,
-		FiberWon: fiberWon / (fiberWon + blxrWon),
+		FiberWon: fiberWon,
+		OtherWon: otherWon,
+		Tied:     tied,
 	}, nil
 
 }
 
-func buildObservationStats(differences []float64) (types.ObservationStatsRow, error) {
+func buildObservationStats(differences []float64, deadBand float64) (types.ObservationStatsRow, error) {
 	empty := types.ObservationStatsRow{}
 
-	fiberWon := float64(0)
-	blxrWon := float64(0)
+	fiberWon, otherWon, tied := types.CountOutcomes(differences, deadBand).Ratios()
 
-	for _, diff := range differences {
-		if diff > 0 {
-			fiberWon++
-		} else {
-			blxrWon++
-		}
-	}
 	// Calculate all stats
 	mean, err := stats.Mean(differences)
 	if err != nil {
@@ -434,6 +1226,8 @@ func buildObservationStats(differences []float64) (types.ObservationStatsRow, er
 		P99:      p99,
 		Min:      min,
 		Max:      max,
-		FiberWon: fiberWon / (fiberWon + blxrWon),
+		FiberWon: fiberWon,
+		OtherWon: otherWon,
+		Tied:     tied,
 	}, err
 }
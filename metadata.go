@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/chainbound/fiber-benchmarks/sinks"
+	"github.com/chainbound/fiber-benchmarks/sources"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// clockSync is the synchronization of the system clock. Offset and errors are in microseconds.
+type clockSync struct {
+	synced   bool
+	offset   int64
+	estError int64
+	maxError int64
+}
+
+var unknownClockSync = clockSync{estError: -1, maxError: -1}
+
+// newRunMetadata returns the metadata of a benchmark that's starting. The other source is nil in Fiber-only mode.
+func newRunMetadata(config *config, ty sinks.InitType, other sources.Source) *types.RunMetadata {
+	host, _ := os.Hostname()
+
+	metadata := &types.RunMetadata{
+		BenchmarkID: config.benchmarkID,
+		Type:        string(ty),
+		Status:      types.RunRunning,
+		StartTime:   time.Now(),
+
+		Host:      host,
+		Region:    config.region,
+		GoVersion: runtime.Version(),
+		GitCommit: gitCommit(),
+
+		FiberMultiplexSize: int64(len(config.fiberConfig().Endpoints)),
+		PerEndpoint:        config.perEndpoint,
+		Sinks:              config.sinks,
+
+		Interval:      milliseconds(config.interval),
+		IntervalCount: int64(config.intervalCount),
+		Warmup:        milliseconds(config.warmup),
+		CrossCheck:    config.crossCheck,
+		TieThreshold:  milliseconds(config.tieThreshold),
+		MaxAbsDiff:    milliseconds(config.maxAbsDiff),
+	}
+
+	for _, endpoint := range config.fiberConfig().Endpoints {
+		metadata.FiberEndpoints = append(metadata.FiberEndpoints, redactEndpoint(endpoint))
+	}
+
+	if other != nil {
+		otherConfig := config.otherSourceConfig()
+		metadata.OtherSource = other.Name()
+		metadata.OtherSourceType = otherConfig.Type
+		for _, endpoint := range otherConfig.Endpoints {
+			metadata.OtherEndpoints = append(metadata.OtherEndpoints, redactEndpoint(endpoint))
+		}
+	}
+
+	return metadata
+}
+
+// recordRunMetadata records a copy of the metadata in the sink with the current clock sync, and flushes it
+// right away so the run is described even if the benchmark crashes later on.
+func recordRunMetadata(ctx context.Context, logger zerolog.Logger, sink sinks.Sink, metadata *types.RunMetadata) {
+	clock := readClockSync()
+	metadata.ClockSynced = clock.synced
+	metadata.ClockOffset = clock.offset
+	metadata.ClockEstError = clock.estError
+	metadata.ClockMaxError = clock.maxError
+	metadata.RecordedAt = time.Now()
+
+	if !clock.synced && metadata.Status == types.RunRunning {
+		logger.Warn().Msg("System clock isn't synchronized, timestamps of other hosts can't be compared")
+	}
+
+	// The sink can be asynchronous, so it gets its own copy
+	record := *metadata
+	sink.RecordRunMetadata(&record)
+	if err := sink.Flush(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to flush sink")
+	}
+}
+
+// finishRunMetadata records the end of a benchmark. Runs that return an error failed, runs that return
+// after an interrupt were interrupted.
+func finishRunMetadata(metadata *types.RunMetadata, interrupted bool, err error) {
+	metadata.EndTime = time.Now()
+
+	switch {
+	case err != nil:
+		metadata.Status = types.RunFailed
+		metadata.Error = err.Error()
+	case interrupted:
+		metadata.Status = types.RunInterrupted
+	default:
+		metadata.Status = types.RunCompleted
+	}
+}
+
+// gitCommit returns the commit the binary was built from, if it was built from a git checkout.
+func gitCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	var commit, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			commit = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+
+	if commit != "" && modified == "true" {
+		commit += "-dirty"
+	}
+
+	return commit
+}
+
+// redactEndpoint removes everything but the scheme and host from URLs, since API keys are often part of
+// the path, query or user info. Other endpoints, like host:port, are returned as is.
+func redactEndpoint(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
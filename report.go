@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/chainbound/fiber-benchmarks/log"
+	"github.com/chainbound/fiber-benchmarks/report"
+	"github.com/chainbound/fiber-benchmarks/sinks/clickhouse"
+	"github.com/chainbound/fiber-benchmarks/sinks/csv"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// loadRun reads a finished transaction benchmark back from a sink. For 'csv', run is the file name the
+// CSV sink wrote to. For 'clickhouse', it's the benchmark ID.
+func loadRun(ctx context.Context, config *config, from, run string) (*types.Run, error) {
+	switch from {
+	case "csv":
+		if run == "" {
+			return nil, fmt.Errorf("log file is required to read from CSV")
+		}
+
+		return csv.ReadRun(run)
+	case "clickhouse":
+		if run == "" {
+			return nil, fmt.Errorf("benchmark ID is required to read from Clickhouse")
+		}
+
+		if config.clickhouse.Endpoint == "" || config.clickhouse.DB == "" {
+			return nil, fmt.Errorf("clickhouse endpoint and database are required")
+		}
+
+		c, err := clickhouse.NewClickhouseClient(&config.clickhouse)
+		if err != nil {
+			return nil, err
+		}
+		defer c.Close()
+
+		return c.LoadRun(ctx, run)
+	default:
+		return nil, fmt.Errorf("invalid source: %s", from)
+	}
+}
+
+// writeReport renders the HTML report of a finished run. If no output file is given, the report is
+// written to <benchmark-id>.html.
+func writeReport(ctx context.Context, config *config, from, output string) error {
+	logger := log.NewLogger("report")
+
+	name := config.logFile
+	if from == "clickhouse" {
+		name = config.benchmarkID
+	}
+
+	run, err := loadRun(ctx, config, from, name)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		output = run.BenchmarkID + ".html"
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	if err := report.Write(f, run, config.deadBand()); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	logger.Info().Str("file", output).Int("observations", len(run.Observations)).Int("intervals", len(run.Stats)).Msg("Report written")
+	return nil
+}
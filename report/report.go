@@ -0,0 +1,498 @@
+// Package report renders a finished transaction benchmark as a self-contained HTML page. Charts are
+// generated as inline SVG, so the page has no external dependencies and can be shared as a single file.
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/montanaflynn/stats"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+const (
+	// Number of bins in the latency histogram
+	histogramBins = 40
+	// Maximum number of points in the CDF line
+	cdfPoints = 500
+	// Number of destination addresses in the segment breakdown
+	topDestinations = 10
+)
+
+//go:embed report.html
+var reportTemplate string
+
+var tmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":       func(v float64) string { return fmt.Sprintf("%.2fms", v) },
+	"percent":  func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+	"ratio":    func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) },
+	"time":     func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05 MST") },
+	"inc":      func(i int) int { return i + 1 },
+	"compared": compared,
+}).Parse(reportTemplate))
+
+// Field is a single name / value pair of run metadata.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Summary describes the latency differences of a set of transactions that were seen by both sources.
+// Differences are other - Fiber in milliseconds, so positive means Fiber was faster. Outcomes are in percent.
+type Summary struct {
+	Name     string
+	Count    int
+	FiberWon float64
+	OtherWon float64
+	Tied     float64
+	Mean     float64
+	P5       float64
+	P50      float64
+	P95      float64
+}
+
+// Coverage counts which source saw the confirmed transactions.
+type Coverage struct {
+	Total     int
+	Both      int
+	FiberOnly int
+	OtherOnly int
+	// Only seen by Fiber while the other source was down, so it's unknown whether the other source would have
+	OtherDown int
+}
+
+func (c Coverage) Percent(n int) float64 {
+	if c.Total == 0 {
+		return 0
+	}
+
+	return float64(n) / float64(c.Total) * 100
+}
+
+// Segment is a breakdown of the differences by a property of the transactions.
+type Segment struct {
+	Title string
+	Rows  []Summary
+}
+
+type report struct {
+	BenchmarkID string
+	Generated   time.Time
+	Metadata    []Field
+	Overall     Summary
+	Coverage    Coverage
+	Segments    []Segment
+	Intervals   []*types.ObservationStatsRow
+	Tainted     int
+	// Intervals where the other source wasn't live, which only have Fiber stats
+	Degraded int
+
+	CDF         template.HTML
+	Histogram   template.HTML
+	WinRatio    template.HTML
+	Percentiles template.HTML
+}
+
+// Write renders the HTML report of the run to w. Differences of at most deadBand milliseconds are ties.
+func Write(w io.Writer, run *types.Run, deadBand float64) error {
+	if len(run.Observations) == 0 && len(run.Stats) == 0 {
+		return fmt.Errorf("run %s has no observations or stats", run.BenchmarkID)
+	}
+
+	r := &report{
+		BenchmarkID: run.BenchmarkID,
+		Generated:   time.Now(),
+		Intervals:   run.Stats,
+	}
+
+	var both []*types.ConfirmedObservationRow
+	for _, row := range run.Observations {
+		r.Coverage.Total++
+
+		switch {
+		case row.FiberTimestamp != 0 && row.OtherTimestamp != 0:
+			r.Coverage.Both++
+			both = append(both, row)
+		case row.FiberTimestamp != 0 && row.OtherDown:
+			r.Coverage.OtherDown++
+		case row.FiberTimestamp != 0:
+			r.Coverage.FiberOnly++
+		case row.OtherTimestamp != 0:
+			r.Coverage.OtherOnly++
+		}
+	}
+
+	for _, interval := range run.Stats {
+		if interval.Tainted {
+			r.Tainted++
+		}
+		if !compared(interval) {
+			r.Degraded++
+		}
+	}
+
+	differences := make([]float64, len(both))
+	for i, row := range both {
+		differences[i] = difference(row)
+	}
+
+	r.Overall = summarize("All", differences, deadBand)
+	r.Metadata = metadata(run, r)
+	r.Segments = segments(both, deadBand)
+	r.CDF = cdfChart(differences)
+	r.Histogram = histogramChart(differences)
+	r.WinRatio = winRatioChart(run.Stats)
+	r.Percentiles = percentilesChart(run.Stats)
+
+	return tmpl.Execute(w, r)
+}
+
+// difference returns other - Fiber in milliseconds, as recorded by the benchmark.
+func difference(row *types.ConfirmedObservationRow) float64 {
+	return float64(row.Difference) / 1000
+}
+
+func summarize(name string, differences []float64, deadBand float64) Summary {
+	s := Summary{Name: name, Count: len(differences)}
+	if len(differences) == 0 {
+		return s
+	}
+
+	fiberWon, otherWon, tied := types.CountOutcomes(differences, deadBand).Ratios()
+	s.FiberWon = fiberWon * 100
+	s.OtherWon = otherWon * 100
+	s.Tied = tied * 100
+	s.Mean, _ = stats.Mean(differences)
+	s.P5, _ = stats.Percentile(differences, 5)
+	s.P50, _ = stats.Percentile(differences, 50)
+	s.P95, _ = stats.Percentile(differences, 95)
+
+	return s
+}
+
+func metadata(run *types.Run, r *report) []Field {
+	fields := []Field{{Name: "Benchmark ID", Value: run.BenchmarkID}}
+
+	if len(run.Stats) > 0 {
+		start, end := run.Stats[0].StartTime, run.Stats[len(run.Stats)-1].EndTime
+		fields = append(fields,
+			Field{Name: "Start", Value: start.UTC().Format(time.RFC3339)},
+			Field{Name: "End", Value: end.UTC().Format(time.RFC3339)},
+			Field{Name: "Duration", Value: end.Sub(start).Round(time.Second).String()},
+		)
+	}
+
+	fields = append(fields,
+		Field{Name: "Intervals", Value: fmt.Sprintf("%d (%d tainted)", len(run.Stats), r.Tainted)},
+		Field{Name: "Confirmed transactions", Value: fmt.Sprintf("%d", r.Coverage.Total)},
+	)
+
+	for _, endpoint := range fiberEndpoints(run.Observations) {
+		fields = append(fields, Field{Name: "Fiber endpoint", Value: endpoint})
+	}
+
+	if run.Metadata != nil {
+		fields = append(fields, runMetadata(run.Metadata)...)
+	}
+
+	return fields
+}
+
+// runMetadata returns the fields of the recorded run metadata. Empty values are left out.
+func runMetadata(m *types.RunMetadata) []Field {
+	clock := "not synchronized"
+	switch {
+	case m.ClockEstError < 0:
+		clock = "unknown"
+	case m.ClockSynced:
+		clock = fmt.Sprintf("synchronized, offset %dµs, estimated error %dµs, maximum error %dµs", m.ClockOffset, m.ClockEstError, m.ClockMaxError)
+	}
+
+	other := "none (Fiber-only)"
+	if m.OtherSource != "" {
+		other = fmt.Sprintf("%s (%s) %s", m.OtherSource, m.OtherSourceType, strings.Join(m.OtherEndpoints, ", "))
+	}
+
+	outliers := "disabled"
+	if m.MaxAbsDiff > 0 {
+		outliers = formatMilliseconds(m.MaxAbsDiff)
+	}
+
+	status := m.Status
+	if m.Error != "" {
+		status += ": " + m.Error
+	}
+
+	fields := []Field{
+		{Name: "Status", Value: status},
+		{Name: "Fiber endpoints", Value: fmt.Sprintf("%s (multiplexing %d, per-endpoint: %t)", strings.Join(m.FiberEndpoints, ", "), m.FiberMultiplexSize, m.PerEndpoint)},
+		{Name: "Other source", Value: other},
+		{Name: "Intervals configured", Value: fmt.Sprintf("%d x %s, warm-up %s", m.IntervalCount, formatMilliseconds(m.Interval), formatMilliseconds(m.Warmup))},
+		{Name: "Cross-check", Value: fmt.Sprintf("%t", m.CrossCheck)},
+		{Name: "Tie threshold", Value: formatMilliseconds(m.TieThreshold)},
+		{Name: "Outlier threshold", Value: outliers},
+		{Name: "Host", Value: m.Host},
+		{Name: "Region", Value: m.Region},
+		{Name: "Go version", Value: m.GoVersion},
+		{Name: "Git commit", Value: m.GitCommit},
+		{Name: "Clock", Value: clock},
+	}
+
+	nonEmpty := fields[:0]
+	for _, field := range fields {
+		if field.Value != "" {
+			nonEmpty = append(nonEmpty, field)
+		}
+	}
+
+	return nonEmpty
+}
+
+func formatMilliseconds(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).String()
+}
+
+func fiberEndpoints(rows []*types.ConfirmedObservationRow) []string {
+	seen := make(map[string]struct{})
+	for _, row := range rows {
+		if row.FiberEndpoint != "" {
+			seen[row.FiberEndpoint] = struct{}{}
+		}
+	}
+
+	endpoints := make([]string, 0, len(seen))
+	for endpoint := range seen {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	return endpoints
+}
+
+// segments breaks the differences down by calldata size, destination and (if recorded) Fiber endpoint.
+func segments(rows []*types.ConfirmedObservationRow, deadBand float64) []Segment {
+	sizeBuckets := []struct {
+		name string
+		max  int64
+	}{
+		{"No calldata", 0},
+		{"1 B - 1 KB", 1 << 10},
+		{"1 KB - 10 KB", 10 << 10},
+		{"> 10 KB", math.MaxInt64},
+	}
+
+	bySize := make([][]float64, len(sizeBuckets))
+	byTo := make(map[string][]float64)
+	byEndpoint := make(map[string][]float64)
+
+	for _, row := range rows {
+		d := difference(row)
+
+		for i, bucket := range sizeBuckets {
+			if row.CallDataSize <= bucket.max {
+				bySize[i] = append(bySize[i], d)
+				break
+			}
+		}
+
+		to := row.To
+		if to == "" {
+			to = "Contract creation"
+		}
+		byTo[to] = append(byTo[to], d)
+
+		if row.FiberEndpoint != "" {
+			byEndpoint[row.FiberEndpoint] = append(byEndpoint[row.FiberEndpoint], d)
+		}
+	}
+
+	size := Segment{Title: "By calldata size"}
+	for i, bucket := range sizeBuckets {
+		if len(bySize[i]) > 0 {
+			size.Rows = append(size.Rows, summarize(bucket.name, bySize[i], deadBand))
+		}
+	}
+
+	segments := []Segment{size, top("By destination (top 10)", byTo, topDestinations, deadBand)}
+	if len(byEndpoint) > 1 {
+		segments = append(segments, top("By Fiber endpoint", byEndpoint, len(byEndpoint), deadBand))
+	}
+
+	return segments
+}
+
+// top returns a segment with the n groups with the most transactions.
+func top(title string, groups map[string][]float64, n int, deadBand float64) Segment {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if len(groups[names[i]]) != len(groups[names[j]]) {
+			return len(groups[names[i]]) > len(groups[names[j]])
+		}
+		return names[i] < names[j]
+	})
+
+	if len(names) > n {
+		names = names[:n]
+	}
+
+	segment := Segment{Title: title}
+	for _, name := range names {
+		segment.Rows = append(segment.Rows, summarize(name, groups[name], deadBand))
+	}
+
+	return segment
+}
+
+// bounds returns the 1st and 99th percentile, so that outliers don't squash the charts.
+func bounds(differences []float64) (float64, float64) {
+	lo, _ := stats.Percentile(differences, 1)
+	hi, _ := stats.Percentile(differences, 99)
+	return lo, hi
+}
+
+func cdfChart(differences []float64) template.HTML {
+	if len(differences) == 0 {
+		return ""
+	}
+
+	sorted := make([]float64, len(differences))
+	copy(sorted, differences)
+	sort.Float64s(sorted)
+
+	lo, hi := bounds(sorted)
+	c := newChart(lo, hi, 0, 1)
+
+	step := len(sorted)/cdfPoints + 1
+	var xs, ys []float64
+	for i := 0; i < len(sorted); i += step {
+		xs = append(xs, sorted[i])
+		ys = append(ys, float64(i+1)/float64(len(sorted)))
+	}
+
+	c.line("", xs, ys, palette[0])
+	c.vline(0, "#6b7280")
+
+	return c.render("Other - Fiber (ms)", "Fraction of transactions", formatMs, formatFraction)
+}
+
+func histogramChart(differences []float64) template.HTML {
+	if len(differences) == 0 {
+		return ""
+	}
+
+	lo, hi := bounds(differences)
+	if hi <= lo {
+		lo, hi = lo-1, hi+1
+	}
+
+	width := (hi - lo) / histogramBins
+	counts := make([]float64, histogramBins)
+	for _, d := range differences {
+		if d < lo || d > hi {
+			continue
+		}
+
+		i := int((d - lo) / width)
+		if i == histogramBins {
+			i--
+		}
+		counts[i]++
+	}
+
+	max, _ := stats.Max(counts)
+	c := newChart(lo, hi, 0, max)
+
+	for i, count := range counts {
+		x0 := lo + float64(i)*width
+		color := palette[0]
+		if x0+width/2 < 0 {
+			color = palette[1]
+		}
+		c.bar(x0, x0+width, count, color)
+	}
+
+	c.vline(0, "#6b7280")
+
+	return c.render("Other - Fiber (ms)", "Transactions", formatMs, formatIndex)
+}
+
+// compared returns true if both sources were live during the interval, so it has a comparison. Intervals that
+// were recorded before live sources were tracked don't have any, and always compared both.
+func compared(interval *types.ObservationStatsRow) bool {
+	return len(interval.LiveSources) != 1
+}
+
+// winRatioChart plots the outcomes of every interval. Intervals without a comparison break the lines.
+func winRatioChart(intervals []*types.ObservationStatsRow) template.HTML {
+	if len(intervals) == 0 {
+		return ""
+	}
+
+	xs := make([]float64, len(intervals))
+	fiberWon := make([]float64, len(intervals))
+	otherWon := make([]float64, len(intervals))
+	tied := make([]float64, len(intervals))
+
+	for i, interval := range intervals {
+		xs[i] = float64(i + 1)
+		if !compared(interval) {
+			fiberWon[i], otherWon[i], tied[i] = math.NaN(), math.NaN(), math.NaN()
+			continue
+		}
+
+		fiberWon[i] = interval.FiberWon * 100
+		otherWon[i] = interval.OtherWon * 100
+		tied[i] = interval.Tied * 100
+	}
+
+	c := newChart(1, float64(len(intervals)), 0, 100)
+	c.line("Fiber won", xs, fiberWon, palette[0])
+	c.line("Other won", xs, otherWon, palette[1])
+	c.line("Tied", xs, tied, palette[3])
+
+	return c.render("Interval", "Share of transactions", formatIndex, formatPercent)
+}
+
+// percentilesChart plots the percentiles of every interval. Intervals without a comparison break the lines.
+func percentilesChart(intervals []*types.ObservationStatsRow) template.HTML {
+	if len(intervals) == 0 {
+		return ""
+	}
+
+	xs := make([]float64, len(intervals))
+	p5 := make([]float64, len(intervals))
+	p50 := make([]float64, len(intervals))
+	p95 := make([]float64, len(intervals))
+	min, max := 0.0, 0.0
+
+	for i, interval := range intervals {
+		xs[i] = float64(i + 1)
+		if !compared(interval) {
+			p5[i], p50[i], p95[i] = math.NaN(), math.NaN(), math.NaN()
+			continue
+		}
+
+		p5[i] = interval.P5
+		p50[i] = interval.P50
+		p95[i] = interval.P95
+		min, max = math.Min(min, interval.P5), math.Max(max, interval.P95)
+	}
+
+	c := newChart(1, float64(len(intervals)), min, max)
+	c.line("p5", xs, p5, palette[1])
+	c.line("p50", xs, p50, palette[0])
+	c.line("p95", xs, p95, palette[2])
+
+	return c.render("Interval", "Other - Fiber (ms)", formatIndex, formatMs)
+}
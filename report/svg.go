@@ -0,0 +1,149 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+)
+
+const (
+	chartWidth   = 720
+	chartHeight  = 280
+	marginLeft   = 60
+	marginRight  = 20
+	marginTop    = 20
+	marginBottom = 40
+	tickCount    = 5
+)
+
+// Colors used for the series in the charts
+var palette = []string{"#2563eb", "#dc2626", "#16a34a", "#9333ea", "#ea580c"}
+
+// chart is a minimal SVG line and bar chart with linear axes.
+type chart struct {
+	xMin, xMax float64
+	yMin, yMax float64
+
+	body   strings.Builder
+	legend []string
+}
+
+func newChart(xMin, xMax, yMin, yMax float64) *chart {
+	// Avoid dividing by zero on empty or constant data
+	if xMax <= xMin {
+		xMin, xMax = xMin-1, xMax+1
+	}
+	if yMax <= yMin {
+		yMin, yMax = yMin-1, yMax+1
+	}
+
+	return &chart{xMin: xMin, xMax: xMax, yMin: yMin, yMax: yMax}
+}
+
+func (c *chart) x(v float64) float64 {
+	return marginLeft + (v-c.xMin)/(c.xMax-c.xMin)*(chartWidth-marginLeft-marginRight)
+}
+
+func (c *chart) y(v float64) float64 {
+	return chartHeight - marginBottom - (v-c.yMin)/(c.yMax-c.yMin)*(chartHeight-marginTop-marginBottom)
+}
+
+// line adds a series. Values outside of the x range are skipped, and NaN values break the line.
+func (c *chart) line(name string, xs, ys []float64, color string) {
+	var points []string
+	flush := func() {
+		switch len(points) {
+		case 0:
+		case 1:
+			// A single point wouldn't show up as a line
+			fmt.Fprintf(&c.body, `<polyline fill="none" stroke="%s" stroke-width="4" stroke-linecap="round" points="%s %s"/>`, color, points[0], points[0])
+		default:
+			fmt.Fprintf(&c.body, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, color, strings.Join(points, " "))
+		}
+		points = nil
+	}
+
+	for i := range xs {
+		if math.IsNaN(ys[i]) {
+			flush()
+			continue
+		}
+		if xs[i] < c.xMin || xs[i] > c.xMax {
+			continue
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", c.x(xs[i]), c.y(ys[i])))
+	}
+
+	flush()
+	c.addLegend(name, color)
+}
+
+// bar adds a bar from x0 to x1 with height y.
+func (c *chart) bar(x0, x1, y float64, color string) {
+	fmt.Fprintf(&c.body, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`,
+		c.x(x0)+0.5, c.y(y), math.Max(c.x(x1)-c.x(x0)-1, 0.5), c.y(c.yMin)-c.y(y), color)
+}
+
+// vline adds a dashed vertical marker line.
+func (c *chart) vline(x float64, color string) {
+	if x < c.xMin || x > c.xMax {
+		return
+	}
+
+	fmt.Fprintf(&c.body, `<line x1="%.1f" x2="%.1f" y1="%d" y2="%d" stroke="%s" stroke-dasharray="4 3"/>`, c.x(x), c.x(x), marginTop, chartHeight-marginBottom, color)
+}
+
+func (c *chart) addLegend(name, color string) {
+	if name == "" {
+		return
+	}
+
+	c.legend = append(c.legend, fmt.Sprintf(`<span class="legend"><i style="background:%s"></i>%s</span>`, color, template.HTMLEscapeString(name)))
+}
+
+// render returns the chart as inline SVG, with axes labelled using the given formatters.
+func (c *chart) render(xLabel, yLabel string, xFmt, yFmt func(float64) string) template.HTML {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" class="chart">`, chartWidth, chartHeight)
+
+	for i := 0; i <= tickCount; i++ {
+		xv := c.xMin + (c.xMax-c.xMin)*float64(i)/tickCount
+		yv := c.yMin + (c.yMax-c.yMin)*float64(i)/tickCount
+
+		fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" class="grid"/>`, marginLeft, chartWidth-marginRight, c.y(yv), c.y(yv))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" class="tick">%s</text>`, marginLeft-6, c.y(yv)+4, yFmt(yv))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle" class="tick">%s</text>`, c.x(xv), chartHeight-marginBottom+16, xFmt(xv))
+	}
+
+	b.WriteString(c.body.String())
+
+	fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%d" y2="%d" class="axis"/>`, marginLeft, chartWidth-marginRight, chartHeight-marginBottom, chartHeight-marginBottom)
+	fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%d" y2="%d" class="axis"/>`, marginLeft, marginLeft, marginTop, chartHeight-marginBottom)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" class="label">%s</text>`, (chartWidth+marginLeft)/2, chartHeight-6, template.HTMLEscapeString(xLabel))
+	fmt.Fprintf(&b, `<text x="14" y="%d" text-anchor="middle" class="label" transform="rotate(-90 14 %d)">%s</text>`, chartHeight/2, chartHeight/2, template.HTMLEscapeString(yLabel))
+	b.WriteString(`</svg>`)
+
+	if len(c.legend) > 0 {
+		b.WriteString(`<div>` + strings.Join(c.legend, "") + `</div>`)
+	}
+
+	return template.HTML(b.String())
+}
+
+func formatMs(v float64) string {
+	return fmt.Sprintf("%.1fms", v)
+}
+
+func formatPercent(v float64) string {
+	return fmt.Sprintf("%.0f%%", v)
+}
+
+func formatFraction(v float64) string {
+	return fmt.Sprintf("%.0f%%", v*100)
+}
+
+func formatIndex(v float64) string {
+	return fmt.Sprintf("%.0f", v)
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/montanaflynn/stats"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+
+	"github.com/chainbound/fiber-benchmarks/log"
+	"github.com/chainbound/fiber-benchmarks/sources"
+	"github.com/chainbound/fiber-benchmarks/sources/bloxroute"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+const (
+	// How often the node is polled for the receipt of a sent transaction
+	receiptPollInterval = 100 * time.Millisecond
+	// How long to keep listening after the last transaction, for sources that stream it back late
+	seenGrace = 2 * time.Second
+)
+
+// Paths that transactions can be sent through
+var sendPaths = []string{"fiber", "bloxroute", "rpc"}
+
+type sendConfig struct {
+	// Paths to send through, round-robin. Defaults to all configured paths.
+	paths cli.StringSlice
+	// Node used for nonces, fees, inclusion and the 'rpc' path
+	rpcEndpoint string
+	// Hex encoded key of the account that sends the self-transfers
+	privateKey string
+	// Fetched from the node if 0
+	chainID int64
+	// Number of transactions to send
+	count int
+	// Time between transactions
+	interval time.Duration
+	// How long to wait for a transaction to be included
+	inclusionTimeout time.Duration
+}
+
+// resolvePaths returns the paths to send through and checks that they're configured.
+func (s *sendConfig) resolvePaths(config *config) ([]string, error) {
+	fiberConfig, blxrConfig := config.fiberConfig(), config.sourceConfigs["bloxroute"]
+	var blxrTransport string
+	if err := blxrConfig.Option("transport", &blxrTransport); err != nil {
+		return nil, err
+	}
+
+	configured := map[string]bool{
+		"fiber":     len(fiberConfig.Endpoints) > 0 && fiberConfig.Key != "",
+		"bloxroute": blxrConfig.Endpoint() != "" && blxrConfig.Key != "",
+		"rpc":       true,
+	}
+
+	paths := s.paths.Value()
+	if len(paths) == 0 {
+		for _, path := range sendPaths {
+			if configured[path] {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	for _, path := range paths {
+		ok, known := configured[path]
+		switch {
+		case !known:
+			return nil, fmt.Errorf("invalid path: %s", path)
+		case !ok:
+			return nil, fmt.Errorf("path %s is not configured", path)
+		case path == "bloxroute" && blxrTransport != "" && blxrTransport != "ws":
+			return nil, fmt.Errorf("sending through bloxroute requires the websocket transport")
+		}
+	}
+
+	return paths, nil
+}
+
+func (s *sendConfig) validate() error {
+	if s.rpcEndpoint == "" {
+		return fmt.Errorf("RPC endpoint is required")
+	}
+
+	if s.privateKey == "" {
+		return fmt.Errorf("private key is required")
+	}
+
+	if s.count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+
+	if s.interval < 0 {
+		return fmt.Errorf("send interval can't be negative")
+	}
+
+	if s.inclusionTimeout <= 0 {
+		return fmt.Errorf("inclusion timeout must be positive")
+	}
+
+	return nil
+}
+
+// A transaction that was sent
+type sentTransaction struct {
+	path string
+	// Timestamp in microseconds right before sending
+	sentAt int64
+	failed bool
+	// First wire timestamp at which each source streamed the transaction back
+	seen map[string]int64
+	// Timestamp at which the receipt was first returned, 0 if it wasn't included
+	includedAt int64
+}
+
+// sendTracker matches the transactions that were sent with the observations of the sources.
+type sendTracker struct {
+	sources []string
+	sent    map[common.Hash]*sentTransaction
+	lock    sync.Mutex
+}
+
+func newSendTracker() *sendTracker {
+	return &sendTracker{sent: make(map[common.Hash]*sentTransaction)}
+}
+
+// listen records when the source first streams back any of the sent transactions.
+func (t *sendTracker) listen(name string, ch chan types.Observation) {
+	t.sources = append(t.sources, name)
+
+	go func() {
+		for obs := range ch {
+			t.lock.Lock()
+			if tx, ok := t.sent[obs.Hash]; ok {
+				if _, seen := tx.seen[name]; !seen {
+					tx.seen[name] = obs.Timestamp
+				}
+			}
+			t.lock.Unlock()
+		}
+	}()
+}
+
+// track registers a transaction right before it's sent, so that it's matched even if a source
+// streams it back before the send returns.
+func (t *sendTracker) track(hash common.Hash, path string) *sentTransaction {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	tx := &sentTransaction{path: path, seen: make(map[string]int64), sentAt: time.Now().UnixMicro()}
+	t.sent[hash] = tx
+	return tx
+}
+
+func (t *sendTracker) print(logger zerolog.Logger, paths []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, path := range paths {
+		var sent, failed int
+		var inclusion []float64
+		seen := make(map[string][]float64)
+
+		for _, tx := range t.sent {
+			if tx.path != path {
+				continue
+			}
+
+			sent++
+			if tx.failed {
+				failed++
+				continue
+			}
+
+			if tx.includedAt != 0 {
+				inclusion = append(inclusion, float64(tx.includedAt-tx.sentAt)/1000)
+			}
+
+			for source, ts := range tx.seen {
+				seen[source] = append(seen[source], float64(ts-tx.sentAt)/1000)
+			}
+		}
+
+		logger.Info().Str("path", path).Msg(fmt.Sprintf("sent: %d | failed: %d | included: %d", sent, failed, len(inclusion)))
+		logger.Info().Str("path", path).Msg("until included " + latencySummary(inclusion))
+
+		for _, source := range t.sources {
+			logger.Info().Str("path", path).Msg(fmt.Sprintf("until seen by %s (%d/%d) %s", source, len(seen[source]), sent-failed, latencySummary(seen[source])))
+		}
+	}
+}
+
+// latencySummary formats the mean, median and p95 of latencies in milliseconds.
+func latencySummary(latencies []float64) string {
+	if len(latencies) == 0 {
+		return "| no data"
+	}
+
+	mean, _ := stats.Mean(latencies)
+	median, _ := stats.Median(latencies)
+	p95, _ := stats.Percentile(latencies, 95)
+
+	return fmt.Sprintf("| mean: %.4fms | median: %.4fms | p95: %.4fms", mean, median, p95)
+}
+
+// runSendBenchmark sends self-transfers round-robin through every path, and measures how long it takes until
+// each source streams them back and until they're included. Transactions are sent one at a time: the next one
+// is sent after the previous one was included, or replaces it with higher fees if it wasn't. On an interrupt, no more
+// transactions are sent and the results so far are printed.
+func runSendBenchmark(ctx context.Context, config *config, send *sendConfig) error {
+	logger := log.NewLogger("send")
+
+	if err := send.validate(); err != nil {
+		return err
+	}
+
+	if err := config.validateOtherSource(); err != nil {
+		return err
+	}
+
+	paths, err := send.resolvePaths(config)
+	if err != nil {
+		return err
+	}
+
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(send.privateKey, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	client, err := ethclient.DialContext(ctx, send.rpcEndpoint)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	chainID := big.NewInt(send.chainID)
+	if send.chainID == 0 {
+		if chainID, err = client.ChainID(ctx); err != nil {
+			return err
+		}
+	}
+
+	tracker := newSendTracker()
+	senders := map[string]func(context.Context, *ethtypes.Transaction) error{
+		"rpc": client.SendTransaction,
+	}
+
+	if fiberConfig := config.fiberConfig(); len(fiberConfig.Endpoints) > 0 && fiberConfig.Key != "" {
+		fiberSource, err := newFiberSource(config)
+		if err != nil {
+			return err
+		}
+
+		if err := fiberSource.Connect(ctx); err != nil {
+			return err
+		}
+		defer fiberSource.Close()
+
+		ch, err := fiberSource.SubscribeTransactionObservations(ctx)
+		if err != nil {
+			return err
+		}
+
+		tracker.listen(fiberSource.Name(), ch)
+		senders["fiber"] = fiberSource.SendTransaction
+	}
+
+	otherSource, err := newOtherSource(config)
+	if err != nil {
+		return err
+	}
+
+	if otherSource, ok := otherSource.(sources.TransactionSource); ok && sources.Has(otherSource, sources.Transactions) {
+		if err := otherSource.Connect(ctx); err != nil {
+			return fmt.Errorf("connecting to %s: %w", otherSource.Name(), err)
+		}
+		defer otherSource.Close()
+
+		ch, err := otherSource.SubscribeTransactionObservations(ctx)
+		if err != nil {
+			return err
+		}
+
+		tracker.listen(otherSource.Name(), ch)
+	}
+
+	if blxrConfig := config.sourceConfigs["bloxroute"]; blxrConfig.Endpoint() != "" && blxrConfig.Key != "" {
+		blxr := bloxroute.NewBloxrouteSource(blxrConfig.Endpoint(), blxrConfig.Key)
+		defer blxr.Close()
+
+		senders["bloxroute"] = blxr.SendTransaction
+	}
+
+	nonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	logger.Info().Str("from", from.Hex()).Uint64("nonce", nonce).Strs("paths", paths).Strs("sources", tracker.sources).Msg("Sending transactions")
+
+	// Sources keep listening with the parent context, so that sent transactions can still be seen after an interrupt
+	sendCtx, stop := interruptible(ctx)
+	defer stop()
+
+	// The last transaction that wasn't included, which the next one replaces if it still has the same nonce
+	var pending *ethtypes.Transaction
+
+	for i := 0; i < send.count; i++ {
+		path := paths[i%len(paths)]
+
+		if pending != nil && pending.Nonce() != nonce {
+			pending = nil
+		}
+
+		tx, err := signSelfTransfer(sendCtx, client, key, chainID, nonce, pending)
+		if sendCtx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		sent := tracker.track(tx.Hash(), path)
+		if err := senders[path](sendCtx, tx); err != nil {
+			logger.Error().Err(err).Str("path", path).Str("hash", tx.Hash().Hex()).Msg("Failed to send transaction")
+			sent.failed = true
+
+			if nonce, err = client.PendingNonceAt(sendCtx, from); err != nil {
+				if sendCtx.Err() != nil {
+					break
+				}
+				return err
+			}
+
+			if !sleep(sendCtx, send.interval) {
+				break
+			}
+			continue
+		}
+
+		logger.Debug().Str("path", path).Str("hash", tx.Hash().Hex()).Uint64("nonce", nonce).Msg("Sent transaction")
+
+		includedAt, err := waitForInclusion(sendCtx, client, tx.Hash(), send.inclusionTimeout)
+		if sendCtx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if includedAt == 0 {
+			logger.Warn().Str("path", path).Str("hash", tx.Hash().Hex()).Msg("Transaction wasn't included, replacing it")
+			pending = tx
+		} else {
+			tracker.lock.Lock()
+			sent.includedAt = includedAt
+			tracker.lock.Unlock()
+
+			nonce++
+			pending = nil
+		}
+
+		if !sleep(sendCtx, send.interval) {
+			break
+		}
+	}
+
+	if sendCtx.Err() != nil {
+		logger.Warn().Msg("Interrupted, not sending any more transactions")
+	}
+
+	sleep(ctx, seenGrace)
+	tracker.print(logger, paths)
+
+	return nil
+}
+
+// signSelfTransfer signs a transfer of 0 to the sender. If it replaces an earlier transaction with the same nonce,
+// its fees are at least 10% higher than those of the earlier one, which is the minimum nodes accept. Chains without
+// a base fee (before London) get a legacy transaction.
+func signSelfTransfer(ctx context.Context, client *ethclient.Client, key *ecdsa.PrivateKey, chainID *big.Int, nonce uint64, replaces *ethtypes.Transaction) (*ethtypes.Transaction, error) {
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := ethtypes.LatestSignerForChainID(chainID)
+	to := crypto.PubkeyToAddress(key.PublicKey)
+
+	if head.BaseFee == nil {
+		gasPrice, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if replaces != nil {
+			gasPrice = bumpFee(gasPrice, replaces.GasPrice())
+		}
+
+		return ethtypes.SignNewTx(key, signer, &ethtypes.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: gasPrice,
+			Gas:      21000,
+			To:       &to,
+		})
+	}
+
+	tip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+
+	if replaces != nil {
+		tip = bumpFee(tip, replaces.GasTipCap())
+		feeCap = bumpFee(feeCap, replaces.GasFeeCap())
+	}
+
+	return ethtypes.SignNewTx(key, signer, &ethtypes.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       21000,
+		To:        &to,
+	})
+}
+
+// bumpFee returns the suggested fee, or the previous fee raised by 10% (rounded up) if that's higher.
+func bumpFee(suggested, previous *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(previous, big.NewInt(110))
+	bumped.Add(bumped, big.NewInt(99))
+	bumped.Div(bumped, big.NewInt(100))
+
+	if suggested.Cmp(bumped) > 0 {
+		return suggested
+	}
+
+	return bumped
+}
+
+// waitForInclusion polls the node for the receipt of the transaction, and returns the timestamp in microseconds
+// at which it was first returned, or 0 if it wasn't included before the timeout.
+func waitForInclusion(ctx context.Context, client *ethclient.Client, hash common.Hash, timeout time.Duration) (int64, error) {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		_, err := client.TransactionReceipt(ctx, hash)
+		if err == nil {
+			return time.Now().UnixMicro(), nil
+		}
+
+		if !errors.Is(err, ethereum.NotFound) {
+			return 0, err
+		}
+
+		if !sleep(ctx, receiptPollInterval) {
+			return 0, ctx.Err()
+		}
+	}
+
+	return 0, nil
+}
+
+// sleep waits for the duration, and returns false if the context was canceled before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,144 @@
+package async
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+
+	"github.com/chainbound/fiber-benchmarks/log"
+	"github.com/chainbound/fiber-benchmarks/sinks"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// OverflowPolicy decides what happens to records when the queue is full
+type OverflowPolicy string
+
+const (
+	// Block the caller until there's room in the queue
+	Block OverflowPolicy = "block"
+	// Drop the record and count it. Only applies to observation rows, the other records always block.
+	Drop OverflowPolicy = "drop"
+)
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch OverflowPolicy(s) {
+	case Block, Drop:
+		return OverflowPolicy(s), nil
+	default:
+		return "", fmt.Errorf("invalid overflow policy: %s", s)
+	}
+}
+
+type op struct {
+	name string
+	fn   func(sinks.Sink) error
+}
+
+// AsyncSink decouples the caller from the underlying sink. Every call is put on a queue and
+// returns immediately, while a single writer goroutine applies them in order. This means Flush
+// doesn't block: the next interval can start collecting while the previous one is persisted.
+type AsyncSink struct {
+	sink   sinks.Sink
+	policy OverflowPolicy
+	log    zerolog.Logger
+
+	queue chan op
+	done  chan struct{}
+
+	// Number of records dropped since the last flush. Accessed atomically.
+	dropped uint64
+}
+
+func NewAsyncSink(sink sinks.Sink, queueSize int, policy OverflowPolicy) *AsyncSink {
+	a := &AsyncSink{
+		sink:   sink,
+		policy: policy,
+		log:    log.NewLogger("sinks"),
+		queue:  make(chan op, queueSize),
+		done:   make(chan struct{}),
+	}
+
+	go a.run()
+
+	return a
+}
+
+func (a *AsyncSink) run() {
+	defer close(a.done)
+
+	for op := range a.queue {
+		if err := op.fn(a.sink); err != nil {
+			a.log.Error().Err(err).Str("op", op.name).Msg("Sink operation failed")
+		}
+	}
+}
+
+// recordObservation enqueues an observation row according to the overflow policy.
+func (a *AsyncSink) recordObservation(name string, fn func(sinks.Sink) error) error {
+	if a.policy == Block {
+		a.queue <- op{name: name, fn: fn}
+		return nil
+	}
+
+	select {
+	case a.queue <- op{name: name, fn: fn}:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+
+	return nil
+}
+
+func (a *AsyncSink) RecordObservationRow(row *types.ConfirmedObservationRow) error {
+	return a.recordObservation("observation", func(s sinks.Sink) error { return s.RecordObservationRow(row) })
+}
+
+func (a *AsyncSink) RecordBlockObservationRow(row *types.BlockObservationRow) error {
+	return a.recordObservation("block observation", func(s sinks.Sink) error { return s.RecordBlockObservationRow(row) })
+}
+
+// RecordStats enqueues the stats of an interval. Stats are never dropped, since a missing row would leave a gap
+// in the per-interval summaries.
+func (a *AsyncSink) RecordStats(stats *types.ObservationStatsRow) error {
+	a.queue <- op{name: "stats", fn: func(s sinks.Sink) error { return s.RecordStats(stats) }}
+	return nil
+}
+
+// RecordBlockStats enqueues the stats of an interval. Like RecordStats, it never drops them.
+func (a *AsyncSink) RecordBlockStats(stats *types.ObservationStatsRow) error {
+	a.queue <- op{name: "block stats", fn: func(s sinks.Sink) error { return s.RecordBlockStats(stats) }}
+	return nil
+}
+
+// RecordRunMetadata enqueues the metadata. Like flushes, metadata is never dropped.
+func (a *AsyncSink) RecordRunMetadata(metadata *types.RunMetadata) error {
+	a.queue <- op{name: "run metadata", fn: func(s sinks.Sink) error { return s.RecordRunMetadata(metadata) }}
+	return nil
+}
+
+// Flush enqueues a flush of the underlying sink and returns immediately. Flushes are never dropped.
+// Errors are logged by the writer goroutine. The context is passed on to the flush, so canceling it
+// aborts the flush even if it's still queued.
+func (a *AsyncSink) Flush(ctx context.Context) error {
+	if dropped := atomic.SwapUint64(&a.dropped, 0); dropped > 0 {
+		a.log.Warn().Uint64("dropped", dropped).Int("queue_size", cap(a.queue)).Msg("Sink queue overflowed, dropped observations")
+	}
+
+	a.queue <- op{name: "flush", fn: func(s sinks.Sink) error { return s.Flush(ctx) }}
+	return nil
+}
+
+// Close waits until all queued operations are applied, then closes the underlying sink.
+func (a *AsyncSink) Close() error {
+	close(a.queue)
+
+	if len(a.queue) > 0 {
+		a.log.Info().Int("queued", len(a.queue)).Msg("Waiting for sink queue to drain")
+	}
+
+	<-a.done
+
+	return a.sink.Close()
+}
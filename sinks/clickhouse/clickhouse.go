@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,11 +17,39 @@ import (
 	"github.com/chainbound/fiber-benchmarks/types"
 )
 
+const (
+	confirmedObservationsTable      = "confirmed_observations"
+	observationStatsTable           = "observation_stats"
+	confirmedBlockObservationsTable = "confirmed_block_observations"
+	blockObservationStatsTable      = "block_observation_stats"
+	observationQuantilesTable       = "observation_quantiles_1m"
+	blockObservationQuantilesTable  = "block_observation_quantiles_1m"
+	benchmarkRunsTable              = "benchmark_runs"
+
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 5
+	defaultBackoff    = 500 * time.Millisecond
+	maxBackoff        = 30 * time.Second
+)
+
 type ClickhouseConfig struct {
 	Endpoint string
 	DB       string
 	Username string
 	Password string
+
+	// Timeout of a single attempt of any ClickHouse operation
+	Timeout time.Duration
+	// Maximum number of attempts of an operation before giving up
+	MaxRetries int
+	// Backoff after the first failed attempt. Doubles after every attempt.
+	Backoff time.Duration
+	// File that rows are spilled to if they can't be inserted. Spilled rows are replayed
+	// once ClickHouse is reachable again. Rows are dropped if empty.
+	SpillFile string
+	// How long observations and stats (including the per-minute quantiles) are kept. Kept forever if 0.
+	ObservationsTTL time.Duration
+	StatsTTL        time.Duration
 }
 
 type ClickhouseSink struct {
@@ -28,19 +57,33 @@ type ClickhouseSink struct {
 	chConn driver.Conn
 	log    zerolog.Logger
 
-	// Batching of rows
-	observationRowBatch driver.Batch
-	statsBatch          driver.Batch
-
 	ty sinks.InitType
 
-	blockObservationRowBatch driver.Batch
-	blockStatsBatch          driver.Batch
+	// Rows that are waiting to be flushed
+	observationRows      []*types.ConfirmedObservationRow
+	stats                []*types.ObservationStatsRow
+	blockObservationRows []*types.BlockObservationRow
+	blockStats           []*types.ObservationStatsRow
+	runMetadata          []*types.RunMetadata
+
+	spillMu sync.Mutex
 }
 
 func NewClickhouseClient(cfg *ClickhouseConfig) (*ClickhouseSink, error) {
 	log := log.NewLogger("clickhouse")
 
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+
+	if cfg.Backoff == 0 {
+		cfg.Backoff = defaultBackoff
+	}
+
 	conn, err := clickhouse.Open(&clickhouse.Options{
 		Addr: []string{cfg.Endpoint},
 		Auth: clickhouse.Auth{
@@ -54,6 +97,7 @@ func NewClickhouseClient(cfg *ClickhouseConfig) (*ClickhouseSink, error) {
 		TLS: &tls.Config{
 			InsecureSkipVerify: true,
 		},
+		DialTimeout: cfg.Timeout,
 	})
 
 	if err != nil {
@@ -67,230 +111,215 @@ func NewClickhouseClient(cfg *ClickhouseConfig) (*ClickhouseSink, error) {
 	}, nil
 }
 
-// Init creates the database and tables if they don't exist, and also prepares the batch statements
-func (c *ClickhouseSink) Init(ty sinks.InitType) error {
-	var err error
-
+// Init creates the database and tables if they don't exist, migrates them to the latest schema, and replays
+// any rows that were spilled during a previous run. The tables of both benchmark types are migrated, since
+// spilled rows can belong to either.
+func (c *ClickhouseSink) Init(ctx context.Context, ty sinks.InitType) error {
 	c.ty = ty
 
 	c.log.Info().Str("endpoint", c.cfg.Endpoint).Str("type", string(ty)).Msg("Setting up Clickhouse database")
-	if err := c.chConn.Exec(context.Background(), fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", c.cfg.DB)); err != nil {
+	if err := c.migrate(ctx, false, false); err != nil {
 		return err
 	}
 
-	c.log.Info().Str("db", c.cfg.DB).Msg("Database created")
+	c.log.Info().Str("db", c.cfg.DB).Msg("Schema up to date")
 
-	switch ty {
-	case sinks.Transactions:
-		if err := c.chConn.Exec(context.Background(), ConfirmedObservationsDDL(c.cfg.DB)); err != nil {
-			return err
-		}
+	if err := c.replaySpill(ctx); err != nil {
+		c.log.Error().Err(err).Msg("Replaying spilled rows failed")
+	}
 
-		if err := c.chConn.Exec(context.Background(), ObservationStatsDDL(c.cfg.DB)); err != nil {
-			return err
-		}
+	return nil
+}
 
-		c.log.Info().Msg("Tables created")
+func (c *ClickhouseSink) Close() error {
+	return c.chConn.Close()
+}
 
-		for {
-			c.observationRowBatch, err = c.chConn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.confirmed_observations", c.cfg.DB))
-			if err != nil {
-				c.log.Error().Err(err).Msg("preparing batch failed, retrying...")
-			} else {
-				break
-			}
+// exec executes a statement with retries.
+func (c *ClickhouseSink) exec(ctx context.Context, query string) error {
+	return c.retry(ctx, "executing statement", func(ctx context.Context) error {
+		return c.chConn.Exec(ctx, query)
+	})
+}
+
+// retry calls fn until it succeeds or the context is canceled, with exponential backoff between attempts.
+// Every attempt gets a context that times out after the configured timeout.
+func (c *ClickhouseSink) retry(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	var err error
+	backoff := c.cfg.Backoff
+
+	for attempt := 1; attempt <= c.cfg.MaxRetries; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+		err = fn(attemptCtx)
+		cancel()
+
+		if err == nil {
+			return nil
 		}
 
-		for {
-			c.statsBatch, err = c.chConn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.observation_stats", c.cfg.DB))
-			if err != nil {
-				c.log.Error().Err(err).Msg("preparing batch failed, retrying...")
-			} else {
-				break
-			}
+		if attempt == c.cfg.MaxRetries {
+			break
 		}
 
-		c.log.Info().Msg("Prepared batches")
-	case sinks.Blocks:
-		if err := c.chConn.Exec(context.Background(), ConfirmedBlockObservationsDDL(c.cfg.DB)); err != nil {
-			return err
+		c.log.Error().Err(err).Int("attempt", attempt).Str("backoff", backoff.String()).Msg(op + " failed, retrying...")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s aborted after %d attempts: %w", op, attempt, err)
+		case <-time.After(backoff):
 		}
 
-		if err := c.chConn.Exec(context.Background(), BlockObservationStatsDDL(c.cfg.DB)); err != nil {
-			return err
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
 		}
+	}
 
-		c.log.Info().Msg("Tables created")
+	return fmt.Errorf("%s failed after %d attempts: %w", op, c.cfg.MaxRetries, err)
+}
 
-		for {
-			c.blockObservationRowBatch, err = c.chConn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.confirmed_block_observations", c.cfg.DB))
-			if err != nil {
-				c.log.Error().Err(err).Msg("preparing batch failed, retrying...")
-			} else {
-				break
-			}
+// insert inserts the rows into the table in a single batch, with retries.
+func insert[T any](ctx context.Context, c *ClickhouseSink, table string, rows []*T) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return c.retry(ctx, "inserting into "+table, func(ctx context.Context) error {
+		batch, err := c.chConn.PrepareBatch(ctx, fmt.Sprintf("INSERT INTO %s.%s", c.cfg.DB, table))
+		if err != nil {
+			return fmt.Errorf("preparing batch: %w", err)
 		}
 
-		for {
-			c.blockStatsBatch, err = c.chConn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.block_observation_stats", c.cfg.DB))
-			if err != nil {
-				c.log.Error().Err(err).Msg("preparing batch failed, retrying...")
-			} else {
-				break
+		for _, row := range rows {
+			if err := batch.AppendStruct(row); err != nil {
+				_ = batch.Abort()
+				return fmt.Errorf("appending row: %w", err)
 			}
 		}
-	}
 
-	return nil
+		return batch.Send()
+	})
 }
 
-func (c *ClickhouseSink) Close() error {
-	return nil
+// flushTable inserts the rows into the table, and spills them to disk if that fails.
+func flushTable[T any](ctx context.Context, c *ClickhouseSink, table string, rows []*T) error {
+	start := time.Now()
+
+	err := insert(ctx, c, table, rows)
+	if err == nil {
+		if len(rows) > 0 {
+			c.log.Debug().Str("table", table).Int("rows", len(rows)).Str("took", time.Since(start).String()).Msg("Inserted batch")
+		}
+		return nil
+	}
+
+	if c.cfg.SpillFile == "" {
+		return fmt.Errorf("%w, dropped %d rows", err, len(rows))
+	}
+
+	if spillErr := spill(c, table, rows); spillErr != nil {
+		return fmt.Errorf("%w, spilling %d rows also failed: %s", err, len(rows), spillErr)
+	}
+
+	c.log.Warn().Str("table", table).Int("rows", len(rows)).Str("file", c.cfg.SpillFile).Msg("Spilled rows to disk")
+	return fmt.Errorf("%w, spilled %d rows to %s", err, len(rows), c.cfg.SpillFile)
 }
 
 // These rows will be added to a batch. To flush the batch, call Flush()
 func (c *ClickhouseSink) RecordObservationRow(row *types.ConfirmedObservationRow) error {
-	return c.observationRowBatch.AppendStruct(row)
+	c.observationRows = append(c.observationRows, row)
+	return nil
 }
 
 // These rows will be added to a batch. To flush the batch, call Flush()
 func (c *ClickhouseSink) RecordBlockObservationRow(row *types.BlockObservationRow) error {
-	return c.blockObservationRowBatch.AppendStruct(row)
+	c.blockObservationRows = append(c.blockObservationRows, row)
+	return nil
 }
 
 func (c *ClickhouseSink) RecordStats(stats *types.ObservationStatsRow) error {
-	return c.statsBatch.AppendStruct(stats)
+	c.stats = append(c.stats, stats)
+	return nil
 }
 
 func (c *ClickhouseSink) RecordBlockStats(stats *types.ObservationStatsRow) error {
-	return c.blockStatsBatch.AppendStruct(stats)
+	c.blockStats = append(c.blockStats, stats)
+	return nil
 }
 
-// Flushes the batches concurrently. This is a blocking call that can take a while.
-func (c *ClickhouseSink) Flush() error {
-	var err error
-	start := time.Now()
-
-	c.log.Debug().Msg("Flushing batches...")
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	switch c.ty {
-	case sinks.Transactions:
-		go func() {
-			defer wg.Done()
-			// Infinite retries for now
-			for {
-				if c.observationRowBatch.IsSent() {
-					break
-				}
-
-				if err := c.observationRowBatch.Send(); err != nil {
-					c.log.Error().Err(err).Msg("sending observation batch failed, retrying...")
-				} else {
-					break
-				}
-			}
+func (c *ClickhouseSink) RecordRunMetadata(metadata *types.RunMetadata) error {
+	c.runMetadata = append(c.runMetadata, metadata)
+	return nil
+}
 
-			c.log.Debug().Str("took", time.Since(start).String()).Msg("Inserted observation batch")
+// Flushes the batches concurrently. This is a blocking call that can take a while, but is bounded
+// by the timeout and retry settings. Rows that can't be inserted are spilled to disk. If the flush
+// succeeds, previously spilled rows are replayed.
+func (c *ClickhouseSink) Flush(ctx context.Context) error {
+	var (
+		observationRows      = c.observationRows
+		stats                = c.stats
+		blockObservationRows = c.blockObservationRows
+		blockStats           = c.blockStats
+		runMetadata          = c.runMetadata
+	)
+
+	c.observationRows = nil
+	c.stats = nil
+	c.blockObservationRows = nil
+	c.blockStats = nil
+	c.runMetadata = nil
 
-			// Reset batch
-			for {
-				c.observationRowBatch, err = c.chConn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.confirmed_observations", c.cfg.DB))
-				if err != nil {
-					c.log.Error().Err(err).Msg("preparing batch failed, retrying")
-				} else {
-					break
-				}
-			}
-		}()
-
-		go func() {
-			defer wg.Done()
-			// Infinite retries for now
-			for {
-				if c.statsBatch.IsSent() {
-					break
-				}
-
-				if err := c.statsBatch.Send(); err != nil {
-					c.log.Error().Err(err).Msg("sending stats batch failed, retrying...")
-				} else {
-					break
-				}
-			}
+	c.log.Debug().Msg("Flushing batches...")
 
-			c.log.Debug().Str("took", time.Since(start).String()).Msg("Inserted stats batch")
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, 5)
+	)
+
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		errs[0] = flushTable(ctx, c, confirmedObservationsTable, observationRows)
+	}()
+
+	go func() {
+		defer wg.Done()
+		errs[1] = flushTable(ctx, c, observationStatsTable, stats)
+	}()
+
+	go func() {
+		defer wg.Done()
+		errs[2] = flushTable(ctx, c, confirmedBlockObservationsTable, blockObservationRows)
+	}()
+
+	go func() {
+		defer wg.Done()
+		errs[3] = flushTable(ctx, c, blockObservationStatsTable, blockStats)
+	}()
+
+	go func() {
+		defer wg.Done()
+		errs[4] = flushTable(ctx, c, benchmarkRunsTable, runMetadata)
+	}()
 
-			// Reset batch
-			for {
-				c.statsBatch, err = c.chConn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.observation_stats", c.cfg.DB))
-				if err != nil {
-					c.log.Error().Err(err).Msg("preparing batch failed, retrying")
-				} else {
-					break
-				}
-			}
-		}()
-	case sinks.Blocks:
-		go func() {
-			defer wg.Done()
-			// Infinite retries for now
-			for {
-				if c.blockObservationRowBatch.IsSent() {
-					break
-				}
-
-				if err := c.blockObservationRowBatch.Send(); err != nil {
-					c.log.Error().Err(err).Msg("sending observation batch failed, retrying...")
-				} else {
-					break
-				}
-			}
+	wg.Wait()
 
-			c.log.Debug().Str("took", time.Since(start).String()).Msg("Inserted observation batch")
+	var failed []string
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
 
-			// Reset batch
-			for {
-				c.blockObservationRowBatch, err = c.chConn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.confirmed_block_observations", c.cfg.DB))
-				if err != nil {
-					c.log.Error().Err(err).Msg("preparing batch failed, retrying")
-				} else {
-					break
-				}
-			}
-		}()
-
-		go func() {
-			defer wg.Done()
-			// Infinite retries for now
-			for {
-				if c.blockStatsBatch.IsSent() {
-					break
-				}
-
-				if err := c.blockStatsBatch.Send(); err != nil {
-					c.log.Error().Err(err).Msg("sending stats batch failed, retrying...")
-				} else {
-					break
-				}
-			}
+	if len(failed) > 0 {
+		return fmt.Errorf("flushing batches: %s", strings.Join(failed, "; "))
+	}
 
-			c.log.Debug().Str("took", time.Since(start).String()).Msg("Inserted stats batch")
+	c.log.Debug().Msg("Succesfully flushed batches")
 
-			// Reset batch
-			for {
-				c.blockStatsBatch, err = c.chConn.PrepareBatch(context.Background(), fmt.Sprintf("INSERT INTO %s.block_observation_stats", c.cfg.DB))
-				if err != nil {
-					c.log.Error().Err(err).Msg("preparing batch failed, retrying")
-				} else {
-					break
-				}
-			}
-		}()
+	if err := c.replaySpill(ctx); err != nil {
+		return fmt.Errorf("replaying spilled rows: %w", err)
 	}
 
-	wg.Wait()
-	c.log.Debug().Msg("Succesfully flushed batches")
 	return nil
 }
@@ -2,6 +2,9 @@ package clickhouse
 
 import "fmt"
 
+// The DDL below is the initial schema, applied by the first migration. It must not be changed: tables are
+// changed by appending a migration in migrations.go.
+
 func ConfirmedObservationsDDL(db string) string {
 	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.confirmed_observations (
     tx_hash String,
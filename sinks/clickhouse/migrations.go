@@ -0,0 +1,637 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chainbound/fiber-benchmarks/log"
+)
+
+const schemaMigrationsTable = "schema_migrations"
+
+// migration is a versioned change of the schema. Migrations are applied in order, and every applied version is
+// recorded in the schema_migrations table. Statements should be idempotent (IF NOT EXISTS), so tables created
+// before migrations existed, or by a benchmark that's migrating at the same time, are migrated as well.
+type migration struct {
+	version     int
+	description string
+	statements  func(db string) []string
+	// Tables that are copied into new ones. Rows inserted during the copy are lost, and concurrent copies break
+	// each other, so once these tables have rows, the migration is only applied by the migrate command while no
+	// benchmark is running.
+	rewrites []string
+}
+
+// migrations are all migrations of the schema, in order. Append new migrations, never change applied ones.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create tables",
+		statements: func(db string) []string {
+			return []string{
+				ConfirmedObservationsDDL(db),
+				ObservationStatsDDL(db),
+				ConfirmedBlockObservationsDDL(db),
+				BlockObservationStatsDDL(db),
+			}
+		},
+	},
+	{
+		version:     2,
+		description: "add fiber endpoint",
+		statements: func(db string) []string {
+			return []string{
+				addColumns(db, confirmedObservationsTable, "fiber_endpoint String"),
+			}
+		},
+	},
+	{
+		version:     3,
+		description: "add wire timestamps",
+		statements: func(db string) []string {
+			return []string{
+				addColumns(db, confirmedObservationsTable, "fiber_wire_timestamp Int64", "other_wire_timestamp Int64"),
+				addColumns(db, confirmedBlockObservationsTable, "fiber_wire_timestamp Int64", "other_wire_timestamp Int64"),
+			}
+		},
+	},
+	{
+		version:     4,
+		description: "add benchmarker health",
+		statements: func(db string) []string {
+			columns := []string{
+				"tainted Bool",
+				"max_buffer_occupancy Float64",
+				"blocking_events Int64",
+				"gc_pause_max Float64",
+				"sched_latency_p99 Float64",
+			}
+
+			return []string{
+				addColumns(db, observationStatsTable, columns...),
+				addColumns(db, blockObservationStatsTable, columns...),
+			}
+		},
+	},
+	{
+		version:     5,
+		description: "add ties",
+		statements: func(db string) []string {
+			return []string{
+				addColumns(db, observationStatsTable, "other_won Float64", "tied Float64"),
+				addColumns(db, blockObservationStatsTable, "other_won Float64", "tied Float64"),
+			}
+		},
+	},
+	{
+		version:     6,
+		description: "add inclusion and lead times",
+		statements: func(db string) []string {
+			return []string{
+				addColumns(db, confirmedObservationsTable,
+					"block_number UInt64",
+					"tx_index Int64",
+					"slot_timestamp Int64",
+					"payload_timestamp Int64",
+				),
+				addColumns(db, observationStatsTable,
+					"fiber_payload_lead Float64",
+					"other_payload_lead Float64",
+					"fiber_slot_lead Float64",
+					"other_slot_lead Float64",
+				),
+			}
+		},
+	},
+	{
+		version:     7,
+		description: "add outliers",
+		statements: func(db string) []string {
+			return []string{
+				addColumns(db, observationStatsTable, "outliers Int64"),
+				addColumns(db, blockObservationStatsTable, "outliers Int64"),
+			}
+		},
+	},
+	{
+		version:     8,
+		description: "add duplicates",
+		statements: func(db string) []string {
+			observationColumns := []string{
+				"fiber_duplicates Int64",
+				"other_duplicates Int64",
+				"fiber_last_wire_timestamp Int64",
+				"other_last_wire_timestamp Int64",
+			}
+			statsColumns := []string{"fiber_duplicate_rate Float64", "other_duplicate_rate Float64"}
+
+			return []string{
+				addColumns(db, confirmedObservationsTable, observationColumns...),
+				addColumns(db, confirmedBlockObservationsTable, observationColumns...),
+				addColumns(db, observationStatsTable, statsColumns...),
+				addColumns(db, blockObservationStatsTable, statsColumns...),
+			}
+		},
+	},
+	{
+		version:     9,
+		description: "add absolute stats and live sources",
+		statements: func(db string) []string {
+			columns := []string{
+				"fiber_rate Float64",
+				"other_rate Float64",
+				"fiber_coverage Float64",
+				"other_coverage Float64",
+				"live_sources Array(String)",
+			}
+
+			return []string{
+				addColumns(db, observationStatsTable, columns...),
+				addColumns(db, blockObservationStatsTable, columns...),
+			}
+		},
+	},
+	{
+		version:     10,
+		description: "partition tables by time and sort them by benchmark",
+		rewrites:    []string{confirmedObservationsTable, confirmedBlockObservationsTable, observationStatsTable, blockObservationStatsTable},
+		statements: func(db string) []string {
+			var statements []string
+			statements = append(statements, copyTable(db, confirmedObservationsTable, observationColumnsV10, observationsEngineV10("tx_hash"))...)
+			statements = append(statements, copyTable(db, confirmedBlockObservationsTable, blockObservationColumnsV10, observationsEngineV10("block_hash"))...)
+			statements = append(statements, copyTable(db, observationStatsTable, statsColumnsV10, statsEngineV10)...)
+			statements = append(statements, copyTable(db, blockObservationStatsTable, blockStatsColumnsV10, statsEngineV10)...)
+
+			return statements
+		},
+	},
+	{
+		version:     11,
+		description: "add per-minute quantiles of the differences",
+		statements: func(db string) []string {
+			cutoff := time.Now().UnixMicro()
+			return append(
+				quantilesView(db, confirmedObservationsTable, observationQuantilesTable, cutoff),
+				quantilesView(db, confirmedBlockObservationsTable, blockObservationQuantilesTable, cutoff)...,
+			)
+		},
+	},
+	{
+		version:     12,
+		description: "add benchmark runs",
+		statements: func(db string) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+	benchmark_id String,
+	type LowCardinality(String),
+	status LowCardinality(String),
+	error String,
+	start_time DateTime64(6),
+	end_time DateTime64(6),
+	recorded_at DateTime64(6),
+	intervals Int64,
+	tainted_intervals Int64,
+	host String,
+	region String,
+	go_version String,
+	git_commit String,
+	fiber_endpoints Array(String),
+	fiber_multiplex_size Int64,
+	per_endpoint Bool,
+	other_source String,
+	other_source_type String,
+	other_endpoints Array(String),
+	sinks Array(String),
+	interval Float64,
+	interval_count Int64,
+	warmup Float64,
+	cross_check Bool,
+	tie_threshold Float64,
+	max_abs_diff Float64,
+	clock_synced Bool,
+	clock_offset Int64,
+	clock_est_error Int64,
+	clock_max_error Int64
+) ENGINE = ReplacingMergeTree(recorded_at)
+PARTITION BY toYYYYMM(start_time)
+ORDER BY (benchmark_id, type, start_time)`, db, benchmarkRunsTable),
+			}
+		},
+	},
+	{
+		version:     13,
+		description: "record the runs of benchmarks that predate run metadata",
+		statements: func(db string) []string {
+			return []string{
+				backfillRuns(db, observationStatsTable, "transactions"),
+				backfillRuns(db, blockObservationStatsTable, "blocks"),
+			}
+		},
+	},
+	{
+		version:     14,
+		description: "mark observations recorded while the other source was down",
+		statements: func(db string) []string {
+			return []string{
+				addColumns(db, confirmedObservationsTable, "other_down Bool"),
+				addColumns(db, confirmedBlockObservationsTable, "other_down Bool"),
+			}
+		},
+	},
+}
+
+// addColumns returns the statement that adds the columns to the table if they don't exist.
+func addColumns(db, table string, columns ...string) string {
+	clauses := make([]string, len(columns))
+	for i, column := range columns {
+		clauses[i] = "ADD COLUMN IF NOT EXISTS " + column
+	}
+
+	return fmt.Sprintf("ALTER TABLE %s.%s %s", db, table, strings.Join(clauses, ", "))
+}
+
+// Quantiles of the per-minute quantiles tables
+const quantileLevels = "0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99"
+
+// observedAt is the first timestamp of an observation, by whichever source saw it first.
+const observedAt = "fromUnixTimestamp64Micro(if(fiber_timestamp = 0, other_timestamp, if(other_timestamp = 0, fiber_timestamp, least(fiber_timestamp, other_timestamp))))"
+
+var (
+	observationColumnsV10 = []string{
+		"tx_hash String",
+		"fiber_timestamp Int64",
+		"other_timestamp Int64",
+		"fiber_wire_timestamp Int64",
+		"other_wire_timestamp Int64",
+		"difference Int64",
+		"benchmark_id String",
+		"from String",
+		"to String",
+		"calldata_size Int64",
+		"fiber_endpoint String",
+		"block_number UInt64",
+		"tx_index Int64",
+		"slot_timestamp Int64",
+		"payload_timestamp Int64",
+		"fiber_duplicates Int64",
+		"other_duplicates Int64",
+		"fiber_last_wire_timestamp Int64",
+		"other_last_wire_timestamp Int64",
+	}
+
+	blockObservationColumnsV10 = []string{
+		"block_hash String",
+		"fiber_timestamp Int64",
+		"other_timestamp Int64",
+		"fiber_wire_timestamp Int64",
+		"other_wire_timestamp Int64",
+		"difference Int64",
+		"benchmark_id String",
+		"transactions_len Int64",
+		"fiber_duplicates Int64",
+		"other_duplicates Int64",
+		"fiber_last_wire_timestamp Int64",
+		"other_last_wire_timestamp Int64",
+	}
+
+	blockStatsColumnsV10 = []string{
+		"start_time DateTime64",
+		"end_time DateTime64",
+		"min Float64",
+		"max Float64",
+		"benchmark_id String",
+		"mean Float64",
+		"fiber_won Float64",
+		"other_won Float64",
+		"tied Float64",
+		"p1 Float64",
+		"p5 Float64",
+		"p10 Float64",
+		"p15 Float64",
+		"p20 Float64",
+		"p25 Float64",
+		"p30 Float64",
+		"p35 Float64",
+		"p40 Float64",
+		"p45 Float64",
+		"p50 Float64",
+		"p55 Float64",
+		"p60 Float64",
+		"p65 Float64",
+		"p70 Float64",
+		"p75 Float64",
+		"p80 Float64",
+		"p85 Float64",
+		"p90 Float64",
+		"p95 Float64",
+		"p99 Float64",
+		"outliers Int64",
+		"fiber_duplicate_rate Float64",
+		"other_duplicate_rate Float64",
+		"tainted Bool",
+		"max_buffer_occupancy Float64",
+		"blocking_events Int64",
+		"gc_pause_max Float64",
+		"sched_latency_p99 Float64",
+		"fiber_rate Float64",
+		"other_rate Float64",
+		"fiber_coverage Float64",
+		"other_coverage Float64",
+		"live_sources Array(String)",
+	}
+
+	statsColumnsV10 = append(append([]string{}, blockStatsColumnsV10...),
+		"fiber_payload_lead Float64",
+		"other_payload_lead Float64",
+		"fiber_slot_lead Float64",
+		"other_slot_lead Float64",
+	)
+)
+
+// observationsEngineV10 partitions observations by month of the first observation, and sorts them by benchmark.
+func observationsEngineV10(hash string) string {
+	return fmt.Sprintf(`,
+	observed_at DateTime64(6) MATERIALIZED %s
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(observed_at)
+ORDER BY (benchmark_id, observed_at, %s)`, observedAt, hash)
+}
+
+const statsEngineV10 = `
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(start_time)
+ORDER BY (benchmark_id, start_time)`
+
+// copyTable returns the statements that replace the table with a new table with the given columns and engine,
+// and copy its rows. The engine also closes the column list, so it can add columns of its own. The new table is
+// created as <table>_next, and the old one is renamed to <table>_old before it's dropped.
+func copyTable(db, table string, columns []string, engine string) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = "`" + strings.Fields(column)[0] + "`"
+	}
+
+	var (
+		current = db + "." + table
+		next    = current + "_next"
+		old     = current + "_old"
+		list    = strings.Join(names, ", ")
+	)
+
+	return []string{
+		fmt.Sprintf("CREATE TABLE %s (\n\t%s%s", next, strings.Join(columns, ",\n\t"), engine),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", next, list, list, current),
+		fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", current, old, next, current),
+		"DROP TABLE " + old,
+	}
+}
+
+// quantilesView returns the statements that create a table with the per-minute quantiles of the differences of
+// an observation table, a materialized view that keeps it up to date, and fill it with the existing rows. Only
+// observations of both sources are included. See backfill for the cutoff.
+func quantilesView(db, source, table string, cutoff int64) []string {
+	query := func(filter string) string {
+		return fmt.Sprintf(`SELECT
+	benchmark_id,
+	toStartOfMinute(toDateTime(observed_at)) AS minute,
+	count() AS observations,
+	quantilesTDigestState(%s)(difference) AS difference
+FROM %s.%s
+WHERE fiber_timestamp != 0 AND other_timestamp != 0 AND %s
+GROUP BY benchmark_id, minute`, quantileLevels, db, source, filter)
+	}
+
+	return append([]string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+	benchmark_id String,
+	minute DateTime,
+	observations SimpleAggregateFunction(sum, UInt64),
+	difference AggregateFunction(quantilesTDigest(%s), Int64)
+) ENGINE = AggregatingMergeTree()
+PARTITION BY toYYYYMM(minute)
+ORDER BY (benchmark_id, minute)`, db, table, quantileLevels),
+	}, backfill(db, table, table+"_mv", "observed_at", query, cutoff)...)
+}
+
+// backfillRuns returns the statement that records the runs of a stats table that don't have a record in the
+// benchmark runs table yet, i.e. the runs of benchmarks that didn't record run metadata. Their status is empty.
+func backfillRuns(db, source, ty string) string {
+	return fmt.Sprintf(`INSERT INTO %s.%s (benchmark_id, type, start_time, end_time, recorded_at, intervals, tainted_intervals)
+SELECT
+	benchmark_id,
+	'%s' AS type,
+	min(start_time),
+	max(end_time),
+	max(end_time),
+	count(),
+	countIf(tainted)
+FROM %s.%s
+WHERE benchmark_id NOT IN (SELECT benchmark_id FROM %s.%s WHERE type = '%s')
+GROUP BY benchmark_id`, db, benchmarkRunsTable, ty, db, source, db, benchmarkRunsTable, ty)
+}
+
+// backfill returns the statements that create a materialized view of the query into the table, and fill the table
+// with the existing rows. The cutoff (in microseconds) on the column splits the rows between them, so that rows
+// inserted while the view is created aren't counted twice: the view only selects rows after the cutoff, and the
+// backfill the rows up to it. The backfill is skipped if the table already has rows, so a retry doesn't apply it
+// twice.
+func backfill(db, table, view, column string, query func(filter string) string, cutoff int64) []string {
+	at := fmt.Sprintf("fromUnixTimestamp64Micro(toInt64(%d))", cutoff)
+
+	return []string{
+		fmt.Sprintf("CREATE MATERIALIZED VIEW IF NOT EXISTS %s.%s TO %s.%s AS %s", db, view, db, table, query(column+" > "+at)),
+		fmt.Sprintf("INSERT INTO %s.%s %s", db, table, query(fmt.Sprintf("%s <= %s AND (SELECT count() FROM %s.%s) = 0", column, at, db, table))),
+	}
+}
+
+func schemaMigrationsDDL(db string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+	version UInt32,
+	description String,
+	applied_at DateTime64
+) ENGINE = MergeTree()
+PRIMARY KEY (version)`, db, schemaMigrationsTable)
+}
+
+// Migrate creates the database if it doesn't exist, applies all pending migrations and changes the TTLs of
+// the tables to the configured TTLs. With dryRun, the statements are printed instead, and nothing is changed.
+// No benchmark may be running, since migrations can rewrite tables.
+func (c *ClickhouseSink) Migrate(ctx context.Context, dryRun bool) error {
+	return c.migrate(ctx, dryRun, true)
+}
+
+// migrate applies the pending migrations like Migrate. Unless rewrite is set, it refuses to apply migrations that
+// rewrite tables with rows. It always refuses while tables of an unfinished copy exist.
+func (c *ClickhouseSink) migrate(ctx context.Context, dryRun, rewrite bool) error {
+	version, err := c.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if m.version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	c.log.Info().Str("db", c.cfg.DB).Int("version", version).Int("pending", len(pending)).Msg("Checked schema version")
+
+	copies, err := c.unfinishedCopies(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(copies) > 0 {
+		return fmt.Errorf("found tables of a running or failed migration (%s): wait for it to finish, or drop them and run migrate again if it failed", strings.Join(copies, ", "))
+	}
+
+	if !rewrite {
+		for _, m := range pending {
+			for _, table := range m.rewrites {
+				rows, err := c.tableRows(ctx, table)
+				if err != nil {
+					return err
+				}
+
+				// Nothing can be lost by rewriting missing or empty tables
+				if rows > 0 {
+					return fmt.Errorf("migration %d (%s) rewrites %s, which has rows: stop all benchmarks using %s and run the migrate command", m.version, m.description, table, c.cfg.DB)
+				}
+			}
+		}
+	}
+
+	if dryRun {
+		for _, m := range pending {
+			printStatements(fmt.Sprintf("Migration %d: %s", m.version, m.description), m.statements(c.cfg.DB))
+		}
+	} else if err := c.applyMigrations(ctx, pending); err != nil {
+		return err
+	}
+
+	// Only run after the migrations, since they can create or replace tables
+	ttlStatements, err := c.ttlStatements(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		printStatements("TTL", ttlStatements)
+		return nil
+	}
+
+	for _, statement := range ttlStatements {
+		if err := c.exec(ctx, statement); err != nil {
+			return fmt.Errorf("changing TTL: %w", err)
+		}
+
+		c.log.Info().Str("statement", statement).Msg("Changed TTL")
+	}
+
+	return nil
+}
+
+func (c *ClickhouseSink) applyMigrations(ctx context.Context, pending []migration) error {
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := c.exec(ctx, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", c.cfg.DB)); err != nil {
+		return err
+	}
+
+	if err := c.exec(ctx, schemaMigrationsDDL(c.cfg.DB)); err != nil {
+		return err
+	}
+
+	for _, m := range pending {
+		for _, statement := range m.statements(c.cfg.DB) {
+			if err := c.exec(ctx, statement); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+			}
+		}
+
+		if err := c.retry(ctx, "recording migration", func(ctx context.Context) error {
+			return c.chConn.Exec(ctx, fmt.Sprintf("INSERT INTO %s.%s (version, description, applied_at) VALUES (?, ?, now64())", c.cfg.DB, schemaMigrationsTable), m.version, m.description)
+		}); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+		}
+
+		c.log.Info().Int("version", m.version).Str("description", m.description).Msg("Applied migration")
+	}
+
+	return nil
+}
+
+func printStatements(title string, statements []string) {
+	if len(statements) == 0 {
+		return
+	}
+
+	fmt.Fprintf(log.Console, "-- %s\n", title)
+	for _, statement := range statements {
+		fmt.Fprintf(log.Console, "%s;\n\n", statement)
+	}
+}
+
+// unfinishedCopies returns the tables that copyTable leaves behind while it runs, or if it fails.
+func (c *ClickhouseSink) unfinishedCopies(ctx context.Context) ([]string, error) {
+	var tables []string
+
+	err := c.retry(ctx, "checking for unfinished migrations", func(ctx context.Context) error {
+		tables = nil
+
+		rows, err := c.chConn.Query(ctx, "SELECT name FROM system.tables WHERE database = ? AND (endsWith(name, '_next') OR endsWith(name, '_old'))", c.cfg.DB)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			tables = append(tables, name)
+		}
+
+		return rows.Err()
+	})
+
+	return tables, err
+}
+
+// tableRows returns the number of rows in the table, or 0 if it doesn't exist.
+func (c *ClickhouseSink) tableRows(ctx context.Context, table string) (uint64, error) {
+	var rows uint64
+
+	err := c.retry(ctx, "counting rows of "+table, func(ctx context.Context) error {
+		return c.chConn.QueryRow(ctx, "SELECT ifNull(sum(total_rows), 0) FROM system.tables WHERE database = ? AND name = ?", c.cfg.DB, table).Scan(&rows)
+	})
+
+	return rows, err
+}
+
+// schemaVersion returns the version of the latest applied migration, or 0 if none were applied.
+func (c *ClickhouseSink) schemaVersion(ctx context.Context) (int, error) {
+	var version uint32
+
+	err := c.retry(ctx, "reading schema version", func(ctx context.Context) error {
+		var tables uint64
+		if err := c.chConn.QueryRow(ctx, "SELECT count() FROM system.tables WHERE database = ? AND name = ?", c.cfg.DB, schemaMigrationsTable).Scan(&tables); err != nil {
+			return err
+		}
+
+		if tables == 0 {
+			version = 0
+			return nil
+		}
+
+		return c.chConn.QueryRow(ctx, fmt.Sprintf("SELECT max(version) FROM %s.%s", c.cfg.DB, schemaMigrationsTable)).Scan(&version)
+	})
+
+	return int(version), err
+}
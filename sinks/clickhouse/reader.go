@@ -0,0 +1,77 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// LoadRun loads a completed transaction benchmark with the given ID.
+func (c *ClickhouseSink) LoadRun(ctx context.Context, benchmarkID string) (*types.Run, error) {
+	observations, err := selectRows[types.ConfirmedObservationRow](ctx, c, confirmedObservationsTable, benchmarkID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := selectRows[types.ObservationStatsRow](ctx, c, observationStatsTable, benchmarkID, "start_time")
+	if err != nil {
+		return nil, err
+	}
+
+	// A benchmark ID can be reused, the metadata is of the latest run
+	metadata, err := selectRows[types.RunMetadata](ctx, c, benchmarkRunsTable, benchmarkID, "start_time DESC, recorded_at DESC LIMIT 1")
+	if err != nil {
+		return nil, err
+	}
+
+	run := &types.Run{
+		BenchmarkID:  benchmarkID,
+		Observations: observations,
+		Stats:        stats,
+	}
+
+	if len(metadata) > 0 {
+		run.Metadata = metadata[0]
+	}
+
+	return run, nil
+}
+
+// selectRows selects all rows of a benchmark from the table, optionally ordered by a column.
+func selectRows[T any](ctx context.Context, c *ClickhouseSink, table, benchmarkID, orderBy string) ([]*T, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s.%s WHERE benchmark_id = ?", columns[T](), c.cfg.DB, table)
+	if orderBy != "" {
+		query += " ORDER BY " + orderBy
+	}
+
+	var rows []T
+	if err := c.retry(ctx, "selecting from "+table, func(ctx context.Context) error {
+		return c.chConn.Select(ctx, &rows, query, benchmarkID)
+	}); err != nil {
+		return nil, err
+	}
+
+	result := make([]*T, 0, len(rows))
+	for i := range rows {
+		result = append(result, &rows[i])
+	}
+
+	return result, nil
+}
+
+// columns returns the quoted column names of a row type, based on its `ch` struct tags.
+func columns[T any]() string {
+	ty := reflect.TypeOf(*new(T))
+
+	names := make([]string, 0, ty.NumField())
+	for i := 0; i < ty.NumField(); i++ {
+		if name := ty.Field(i).Tag.Get("ch"); name != "" {
+			names = append(names, "`"+name+"`")
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
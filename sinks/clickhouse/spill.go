@@ -0,0 +1,194 @@
+package clickhouse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// A single row in the spill file. The spill file is a write-ahead log of rows that couldn't be
+// inserted, stored as JSON lines.
+type spillRecord struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// spill appends the rows to the spill file.
+func spill[T any](c *ClickhouseSink, table string, rows []*T) error {
+	c.spillMu.Lock()
+	defer c.spillMu.Unlock()
+
+	f, err := os.OpenFile(c.cfg.SpillFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	for _, row := range rows {
+		raw, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+
+		if err := enc.Encode(spillRecord{Table: table, Row: raw}); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// replaySpill inserts all rows from the spill file. Rows of tables that were inserted successfully are
+// removed from the file, the others are kept for the next attempt.
+func (c *ClickhouseSink) replaySpill(ctx context.Context) error {
+	if c.cfg.SpillFile == "" {
+		return nil
+	}
+
+	c.spillMu.Lock()
+	defer c.spillMu.Unlock()
+
+	records, err := readSpill(c.cfg.SpillFile)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	var (
+		tables = make(map[string][]json.RawMessage)
+		order  []string
+	)
+
+	for _, record := range records {
+		if _, ok := tables[record.Table]; !ok {
+			order = append(order, record.Table)
+		}
+		tables[record.Table] = append(tables[record.Table], record.Row)
+	}
+
+	var (
+		remaining []spillRecord
+		firstErr  error
+	)
+
+	for _, table := range order {
+		rows := tables[table]
+
+		switch table {
+		case confirmedObservationsTable:
+			err = replay[types.ConfirmedObservationRow](ctx, c, table, rows)
+		case confirmedBlockObservationsTable:
+			err = replay[types.BlockObservationRow](ctx, c, table, rows)
+		case observationStatsTable, blockObservationStatsTable:
+			err = replay[types.ObservationStatsRow](ctx, c, table, rows)
+		case benchmarkRunsTable:
+			err = replay[types.RunMetadata](ctx, c, table, rows)
+		default:
+			err = fmt.Errorf("unknown table: %s", table)
+		}
+
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			for _, row := range rows {
+				remaining = append(remaining, spillRecord{Table: table, Row: row})
+			}
+			continue
+		}
+
+		c.log.Info().Str("table", table).Int("rows", len(rows)).Msg("Replayed spilled rows")
+	}
+
+	if err := rewriteSpill(c.cfg.SpillFile, remaining); err != nil {
+		return err
+	}
+
+	return firstErr
+}
+
+func replay[T any](ctx context.Context, c *ClickhouseSink, table string, raws []json.RawMessage) error {
+	rows := make([]*T, 0, len(raws))
+	for _, raw := range raws {
+		row := new(T)
+		if err := json.Unmarshal(raw, row); err != nil {
+			return fmt.Errorf("decoding spilled row: %w", err)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return insert(ctx, c, table, rows)
+}
+
+func readSpill(path string) ([]spillRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []spillRecord
+	dec := json.NewDecoder(f)
+	for {
+		var record spillRecord
+		if err := dec.Decode(&record); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// rewriteSpill atomically replaces the spill file with the given records, or removes it if there are none.
+func rewriteSpill(path string, records []spillRecord) error {
+	if len(records) == 0 {
+		return os.Remove(path)
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
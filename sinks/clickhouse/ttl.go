@@ -0,0 +1,66 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ttlRule is how long the rows of a table are kept, based on the expression of their time.
+type ttlRule struct {
+	table string
+	time  string
+	ttl   time.Duration
+}
+
+func (c *ClickhouseSink) ttlRules() []ttlRule {
+	return []ttlRule{
+		{table: confirmedObservationsTable, time: "toDateTime(observed_at)", ttl: c.cfg.ObservationsTTL},
+		{table: confirmedBlockObservationsTable, time: "toDateTime(observed_at)", ttl: c.cfg.ObservationsTTL},
+		{table: observationStatsTable, time: "toDateTime(end_time)", ttl: c.cfg.StatsTTL},
+		{table: blockObservationStatsTable, time: "toDateTime(end_time)", ttl: c.cfg.StatsTTL},
+		{table: observationQuantilesTable, time: "minute", ttl: c.cfg.StatsTTL},
+		{table: blockObservationQuantilesTable, time: "minute", ttl: c.cfg.StatsTTL},
+	}
+}
+
+// ttlStatements returns the statements that change the TTLs of the tables to the configured TTLs. Tables that
+// already have the configured TTL are left alone, since changing a TTL rewrites the table.
+func (c *ClickhouseSink) ttlStatements(ctx context.Context) ([]string, error) {
+	var statements []string
+
+	for _, rule := range c.ttlRules() {
+		engine, err := c.engine(ctx, rule.table)
+		if err != nil {
+			return nil, err
+		}
+
+		table := c.cfg.DB + "." + rule.table
+		if rule.ttl == 0 {
+			if strings.Contains(engine, " TTL ") {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s REMOVE TTL", table))
+			}
+			continue
+		}
+
+		// This is how ClickHouse formats the TTL in the engine
+		ttl := fmt.Sprintf("%s + toIntervalSecond(%d)", rule.time, int64(rule.ttl.Seconds()))
+		if !strings.Contains(engine, " TTL "+ttl) {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s MODIFY TTL %s", table, ttl))
+		}
+	}
+
+	return statements, nil
+}
+
+// engine returns the full engine of the table, including its TTL, or an empty string if it doesn't exist.
+func (c *ClickhouseSink) engine(ctx context.Context, table string) (string, error) {
+	var engine string
+
+	err := c.retry(ctx, "reading engine of "+table, func(ctx context.Context) error {
+		return c.chConn.QueryRow(ctx, "SELECT any(engine_full) FROM system.tables WHERE database = ? AND name = ?", c.cfg.DB, table).Scan(&engine)
+	})
+
+	return engine, err
+}
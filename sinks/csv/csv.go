@@ -1,15 +1,49 @@
 package csv
 
 import (
+	"context"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/chainbound/fiber-benchmarks/sinks"
 	"github.com/chainbound/fiber-benchmarks/types"
 )
 
+// Separates the sources in the live_sources column
+const liveSourcesSeparator = ";"
+
+var statsHeader = []string{
+	"start_time", "end_time", "benchmark_id", "fiber_won", "other_won", "tied", "min", "max", "mean",
+	"p1", "p5", "p10", "p15", "p20", "p25", "p30", "p35", "p40", "p45", "p50",
+	"p55", "p60", "p65", "p70", "p75", "p80", "p85", "p90", "p95", "p99",
+	"outliers", "fiber_duplicate_rate", "other_duplicate_rate", "tainted", "max_buffer_occupancy", "blocking_events", "gc_pause_max", "sched_latency_p99",
+	"fiber_payload_lead", "other_payload_lead", "fiber_slot_lead", "other_slot_lead",
+	"fiber_rate", "other_rate", "fiber_coverage", "other_coverage", "live_sources",
+}
+
+func statsRecord(stats *types.ObservationStatsRow) []string {
+	record := []string{stats.StartTime.Format(time.RFC3339Nano), stats.EndTime.Format(time.RFC3339Nano), stats.BenchmarkID}
+	for _, v := range []float64{
+		stats.FiberWon, stats.OtherWon, stats.Tied, stats.Min, stats.Max, stats.Mean,
+		stats.P1, stats.P5, stats.P10, stats.P15, stats.P20, stats.P25, stats.P30, stats.P35, stats.P40, stats.P45, stats.P50,
+		stats.P55, stats.P60, stats.P65, stats.P70, stats.P75, stats.P80, stats.P85, stats.P90, stats.P95, stats.P99,
+	} {
+		record = append(record, fmt.Sprint(v))
+	}
+
+	record = append(record, fmt.Sprint(stats.Outliers), fmt.Sprint(stats.FiberDuplicateRate), fmt.Sprint(stats.OtherDuplicateRate), fmt.Sprint(stats.Tainted), fmt.Sprint(stats.MaxBufferOccupancy), fmt.Sprint(stats.BlockingEvents), fmt.Sprint(stats.GCPauseMax), fmt.Sprint(stats.SchedLatencyP99))
+
+	record = append(record, fmt.Sprint(stats.FiberPayloadLead), fmt.Sprint(stats.OtherPayloadLead), fmt.Sprint(stats.FiberSlotLead), fmt.Sprint(stats.OtherSlotLead))
+
+	return append(record, fmt.Sprint(stats.FiberRate), fmt.Sprint(stats.OtherRate), fmt.Sprint(stats.FiberCoverage), fmt.Sprint(stats.OtherCoverage), strings.Join(stats.LiveSources, liveSourcesSeparator))
+}
+
 type CsvSink struct {
+	fileName    string
 	obsWriter   *csv.Writer
 	statsWriter *csv.Writer
 }
@@ -36,14 +70,15 @@ func NewCsvSink(fileName string, ty sinks.InitType) (*CsvSink, error) {
 
 	switch ty {
 	case sinks.Transactions:
-		obsWriter.Write([]string{"tx_hash", "fiber_timestamp", "other_timestamp", "diff", "from", "to", "calldata_size"})
+		obsWriter.Write([]string{"tx_hash", "fiber_timestamp", "other_timestamp", "fiber_wire_timestamp", "other_wire_timestamp", "diff", "from", "to", "calldata_size", "fiber_endpoint", "block_number", "tx_index", "slot_timestamp", "payload_timestamp", "fiber_duplicates", "other_duplicates", "fiber_last_wire_timestamp", "other_last_wire_timestamp", "other_down"})
 	case sinks.Blocks:
-		obsWriter.Write([]string{"block_hash", "fiber_timestamp", "other_timestamp", "diff", "tx_count"})
+		obsWriter.Write([]string{"block_hash", "fiber_timestamp", "other_timestamp", "fiber_wire_timestamp", "other_wire_timestamp", "diff", "tx_count", "fiber_duplicates", "other_duplicates", "fiber_last_wire_timestamp", "other_last_wire_timestamp", "other_down"})
 	}
 
-	statsWriter.Write([]string{"mean", "p50", "min", "max"})
+	statsWriter.Write(statsHeader)
 
 	return &CsvSink{
+		fileName:    fileName,
 		obsWriter:   obsWriter,
 		statsWriter: statsWriter,
 	}, nil
@@ -54,22 +89,38 @@ func (c *CsvSink) Close() error {
 }
 
 func (c *CsvSink) RecordObservationRow(row *types.ConfirmedObservationRow) error {
-	return c.obsWriter.Write([]string{row.TxHash, fmt.Sprint(row.FiberTimestamp), fmt.Sprint(row.OtherTimestamp), fmt.Sprint(row.Difference), row.From, row.To, fmt.Sprint(row.CallDataSize)})
+	return c.obsWriter.Write([]string{row.TxHash, fmt.Sprint(row.FiberTimestamp), fmt.Sprint(row.OtherTimestamp), fmt.Sprint(row.FiberWireTimestamp), fmt.Sprint(row.OtherWireTimestamp), fmt.Sprint(row.Difference), row.From, row.To, fmt.Sprint(row.CallDataSize), row.FiberEndpoint, fmt.Sprint(row.BlockNumber), fmt.Sprint(row.TxIndex), fmt.Sprint(row.SlotTimestamp), fmt.Sprint(row.PayloadTimestamp), fmt.Sprint(row.FiberDuplicates), fmt.Sprint(row.OtherDuplicates), fmt.Sprint(row.FiberLastWireTimestamp), fmt.Sprint(row.OtherLastWireTimestamp), fmt.Sprint(row.OtherDown)})
 }
 
 func (c *CsvSink) RecordBlockObservationRow(row *types.BlockObservationRow) error {
-	return c.obsWriter.Write([]string{row.BlockHash, fmt.Sprint(row.FiberTimestamp), fmt.Sprint(row.OtherTimestamp), fmt.Sprint(row.Difference), fmt.Sprint(row.TransactionsLen)})
+	return c.obsWriter.Write([]string{row.BlockHash, fmt.Sprint(row.FiberTimestamp), fmt.Sprint(row.OtherTimestamp), fmt.Sprint(row.FiberWireTimestamp), fmt.Sprint(row.OtherWireTimestamp), fmt.Sprint(row.Difference), fmt.Sprint(row.TransactionsLen), fmt.Sprint(row.FiberDuplicates), fmt.Sprint(row.OtherDuplicates), fmt.Sprint(row.FiberLastWireTimestamp), fmt.Sprint(row.OtherLastWireTimestamp), fmt.Sprint(row.OtherDown)})
 }
 
 func (c *CsvSink) RecordStats(stats *types.ObservationStatsRow) error {
-	return c.statsWriter.Write([]string{fmt.Sprint(stats.Mean), fmt.Sprint(stats.P50), fmt.Sprint(stats.Min), fmt.Sprint(stats.Max)})
+	return c.statsWriter.Write(statsRecord(stats))
 }
 
 func (c *CsvSink) RecordBlockStats(stats *types.ObservationStatsRow) error {
-	return c.statsWriter.Write([]string{fmt.Sprint(stats.Mean), fmt.Sprint(stats.P50), fmt.Sprint(stats.Min), fmt.Sprint(stats.Max)})
+	return c.statsWriter.Write(statsRecord(stats))
+}
+
+// RecordRunMetadata writes the metadata to a JSON sidecar file next to the CSV files, replacing the previous
+// record of the run.
+func (c *CsvSink) RecordRunMetadata(metadata *types.RunMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := c.fileName + ".metadata.json"
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
 }
 
-func (c *CsvSink) Flush() error {
+func (c *CsvSink) Flush(_ context.Context) error {
 	c.obsWriter.Flush()
 	c.statsWriter.Flush()
 	return nil
@@ -0,0 +1,268 @@
+package csv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// ReadRun reads back a transaction benchmark that was written by the CSV sink with the same file name.
+// Columns that don't exist in the files (e.g. because they were written by an older version) are left empty.
+func ReadRun(fileName string) (*types.Run, error) {
+	observations, err := readFile(fileName + ".observations.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := observations.header["tx_hash"]; !ok {
+		return nil, fmt.Errorf("%s.observations.csv does not contain transaction observations", fileName)
+	}
+
+	stats, err := readFile(fileName + ".stats.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	run := new(types.Run)
+
+	for _, fields := range stats.rows {
+		r := &record{header: stats.header, fields: fields}
+		row := &types.ObservationStatsRow{
+			StartTime:          r.time("start_time"),
+			EndTime:            r.time("end_time"),
+			BenchmarkID:        r.str("benchmark_id"),
+			FiberWon:           r.float("fiber_won"),
+			OtherWon:           r.float("other_won"),
+			Tied:               r.float("tied"),
+			Min:                r.float("min"),
+			Max:                r.float("max"),
+			Mean:               r.float("mean"),
+			P1:                 r.float("p1"),
+			P5:                 r.float("p5"),
+			P10:                r.float("p10"),
+			P15:                r.float("p15"),
+			P20:                r.float("p20"),
+			P25:                r.float("p25"),
+			P30:                r.float("p30"),
+			P35:                r.float("p35"),
+			P40:                r.float("p40"),
+			P45:                r.float("p45"),
+			P50:                r.float("p50"),
+			P55:                r.float("p55"),
+			P60:                r.float("p60"),
+			P65:                r.float("p65"),
+			P70:                r.float("p70"),
+			P75:                r.float("p75"),
+			P80:                r.float("p80"),
+			P85:                r.float("p85"),
+			P90:                r.float("p90"),
+			P95:                r.float("p95"),
+			P99:                r.float("p99"),
+			Outliers:           r.int("outliers"),
+			FiberDuplicateRate: r.float("fiber_duplicate_rate"),
+			OtherDuplicateRate: r.float("other_duplicate_rate"),
+			Tainted:            r.bool("tainted"),
+			MaxBufferOccupancy: r.float("max_buffer_occupancy"),
+			BlockingEvents:     r.int("blocking_events"),
+			GCPauseMax:         r.float("gc_pause_max"),
+			SchedLatencyP99:    r.float("sched_latency_p99"),
+			FiberPayloadLead:   r.float("fiber_payload_lead"),
+			OtherPayloadLead:   r.float("other_payload_lead"),
+			FiberSlotLead:      r.float("fiber_slot_lead"),
+			OtherSlotLead:      r.float("other_slot_lead"),
+			FiberRate:          r.float("fiber_rate"),
+			OtherRate:          r.float("other_rate"),
+			FiberCoverage:      r.float("fiber_coverage"),
+			OtherCoverage:      r.float("other_coverage"),
+			LiveSources:        r.strs("live_sources"),
+		}
+
+		if r.err != nil {
+			return nil, fmt.Errorf("%s.stats.csv: %w", fileName, r.err)
+		}
+
+		run.Stats = append(run.Stats, row)
+		run.BenchmarkID = row.BenchmarkID
+	}
+
+	for _, fields := range observations.rows {
+		r := &record{header: observations.header, fields: fields}
+		row := &types.ConfirmedObservationRow{
+			TxHash:             r.str("tx_hash"),
+			FiberTimestamp:     r.int("fiber_timestamp"),
+			OtherTimestamp:     r.int("other_timestamp"),
+			FiberWireTimestamp: r.int("fiber_wire_timestamp"),
+			OtherWireTimestamp: r.int("other_wire_timestamp"),
+			Difference:         r.int("diff"),
+			BenchmarkID:        run.BenchmarkID,
+			From:               r.str("from"),
+			To:                 r.str("to"),
+			CallDataSize:       r.int("calldata_size"),
+			FiberEndpoint:      r.str("fiber_endpoint"),
+			BlockNumber:        uint64(r.int("block_number")),
+			TxIndex:            r.int("tx_index"),
+			SlotTimestamp:      r.int("slot_timestamp"),
+			PayloadTimestamp:   r.int("payload_timestamp"),
+
+			FiberDuplicates:        r.int("fiber_duplicates"),
+			OtherDuplicates:        r.int("other_duplicates"),
+			FiberLastWireTimestamp: r.int("fiber_last_wire_timestamp"),
+			OtherLastWireTimestamp: r.int("other_last_wire_timestamp"),
+			OtherDown:              r.bool("other_down"),
+		}
+
+		if r.err != nil {
+			return nil, fmt.Errorf("%s.observations.csv: %w", fileName, r.err)
+		}
+
+		run.Observations = append(run.Observations, row)
+	}
+
+	metadata, err := readMetadata(fileName + ".metadata.json")
+	if err != nil {
+		return nil, err
+	}
+	run.Metadata = metadata
+
+	return run, nil
+}
+
+// readMetadata reads the run metadata sidecar, or returns nil if the run was recorded without one.
+func readMetadata(path string) (*types.RunMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	metadata := new(types.RunMetadata)
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return metadata, nil
+}
+
+type file struct {
+	// Column index by name
+	header map[string]int
+	rows   [][]string
+}
+
+func readFile(path string) (*file, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	// Rows can have a different number of fields than the header if the sink was changed
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	header := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		header[name] = i
+	}
+
+	return &file{header: header, rows: rows[1:]}, nil
+}
+
+// record parses the fields of a single row by column name, and keeps the first error.
+type record struct {
+	header map[string]int
+	fields []string
+	err    error
+}
+
+func (r *record) str(column string) string {
+	i, ok := r.header[column]
+	if !ok || i >= len(r.fields) {
+		return ""
+	}
+
+	return r.fields[i]
+}
+
+// strs returns the list of values in the column, separated like the live sources.
+func (r *record) strs(column string) []string {
+	s := r.str(column)
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, liveSourcesSeparator)
+}
+
+func (r *record) int(column string) int64 {
+	s := r.str(column)
+	if s == "" || r.err != nil {
+		return 0
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		r.err = fmt.Errorf("column %s: %w", column, err)
+	}
+
+	return v
+}
+
+func (r *record) float(column string) float64 {
+	s := r.str(column)
+	if s == "" || r.err != nil {
+		return 0
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		r.err = fmt.Errorf("column %s: %w", column, err)
+	}
+
+	return v
+}
+
+func (r *record) bool(column string) bool {
+	s := r.str(column)
+	if s == "" || r.err != nil {
+		return false
+	}
+
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		r.err = fmt.Errorf("column %s: %w", column, err)
+	}
+
+	return v
+}
+
+func (r *record) time(column string) time.Time {
+	s := r.str(column)
+	if s == "" || r.err != nil {
+		return time.Time{}
+	}
+
+	v, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		r.err = fmt.Errorf("column %s: %w", column, err)
+	}
+
+	return v
+}
@@ -0,0 +1,158 @@
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/chainbound/fiber-benchmarks/log"
+	"github.com/chainbound/fiber-benchmarks/sinks"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// SinkError is an error returned by a single child sink
+type SinkError struct {
+	Sink string
+	Err  error
+}
+
+func (e SinkError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Sink, e.Err)
+}
+
+func (e SinkError) Unwrap() error {
+	return e.Err
+}
+
+// Errors contains the errors of every child sink that failed
+type Errors []SinkError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+type child struct {
+	name string
+	sink sinks.Sink
+	// Number of failed calls since the last flush
+	errors int
+}
+
+// FanoutSink forwards every call to all of its child sinks. A failing (or panicking) child never
+// prevents the others from receiving the call.
+type FanoutSink struct {
+	children []*child
+	log      zerolog.Logger
+}
+
+func NewFanoutSink() *FanoutSink {
+	return &FanoutSink{
+		log: log.NewLogger("sinks"),
+	}
+}
+
+// Add adds a child sink with the given name. The name is used to report errors.
+func (f *FanoutSink) Add(name string, sink sinks.Sink) {
+	f.children = append(f.children, &child{name: name, sink: sink})
+}
+
+// Len returns the number of child sinks.
+func (f *FanoutSink) Len() int {
+	return len(f.children)
+}
+
+// forward calls fn for every child and collects the errors per child.
+func (f *FanoutSink) forward(fn func(sinks.Sink) error) error {
+	var errs Errors
+	for _, c := range f.children {
+		if err := call(c, fn); err != nil {
+			c.errors++
+			errs = append(errs, SinkError{Sink: c.name, Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// call calls fn on the child sink, turning panics into errors.
+func call(c *child, fn func(sinks.Sink) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(c.sink)
+}
+
+func (f *FanoutSink) RecordObservationRow(row *types.ConfirmedObservationRow) error {
+	return f.forward(func(s sinks.Sink) error { return s.RecordObservationRow(row) })
+}
+
+func (f *FanoutSink) RecordBlockObservationRow(row *types.BlockObservationRow) error {
+	return f.forward(func(s sinks.Sink) error { return s.RecordBlockObservationRow(row) })
+}
+
+func (f *FanoutSink) RecordStats(stats *types.ObservationStatsRow) error {
+	return f.forward(func(s sinks.Sink) error { return s.RecordStats(stats) })
+}
+
+func (f *FanoutSink) RecordBlockStats(stats *types.ObservationStatsRow) error {
+	return f.forward(func(s sinks.Sink) error { return s.RecordBlockStats(stats) })
+}
+
+func (f *FanoutSink) RecordRunMetadata(metadata *types.RunMetadata) error {
+	return f.forward(func(s sinks.Sink) error { return s.RecordRunMetadata(metadata) })
+}
+
+// Flushes all child sinks concurrently, so that a slow sink doesn't hold up the others. Errors of
+// individual records since the last flush are reported per sink.
+func (f *FanoutSink) Flush(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs Errors
+	)
+
+	for _, c := range f.children {
+		if c.errors > 0 {
+			f.log.Error().Str("sink", c.name).Int("errors", c.errors).Msg("Sink failed to record rows since last flush")
+			c.errors = 0
+		}
+
+		wg.Add(1)
+		go func(c *child) {
+			defer wg.Done()
+
+			if err := call(c, func(s sinks.Sink) error { return s.Flush(ctx) }); err != nil {
+				mu.Lock()
+				errs = append(errs, SinkError{Sink: c.name, Err: err})
+				mu.Unlock()
+			}
+		}(c)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (f *FanoutSink) Close() error {
+	return f.forward(func(s sinks.Sink) error { return s.Close() })
+}
@@ -0,0 +1,215 @@
+// Package jsonl implements a sink that writes every row as a JSON object on its own line, for pipelines like jq,
+// Vector or Kafka tooling.
+package jsonl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// Values of the type field of every line
+const (
+	ObservationType      = "observation"
+	BlockObservationType = "block_observation"
+	StatsType            = "stats"
+	BlockStatsType       = "block_stats"
+	RunMetadataType      = "run_metadata"
+)
+
+// Stdout is the file name that writes to stdout instead of a file
+const Stdout = "-"
+
+type Config struct {
+	// File to write to, or '-' for stdout
+	File string
+	// The file is rotated before it would exceed this many bytes. Disabled if 0.
+	MaxSize int64
+	// The file is rotated once it's been written to for this long. Disabled if 0.
+	RotateInterval time.Duration
+}
+
+// JsonlSink writes one JSON object per row. Fields are named like the Clickhouse columns, and every object has a
+// type field that tells the rows apart. Rotated files are renamed to <name>-<timestamp><ext>, and writing
+// continues in a new file with the original name.
+type JsonlSink struct {
+	cfg *Config
+
+	file *os.File
+	w    *bufio.Writer
+	// Bytes written to the current file, and when it was opened
+	size   int64
+	opened time.Time
+}
+
+func NewJsonlSink(cfg *Config) (*JsonlSink, error) {
+	s := &JsonlSink{cfg: cfg}
+
+	if cfg.File == Stdout {
+		s.w = bufio.NewWriter(os.Stdout)
+		return s, nil
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// open opens the file for appending, so restarts continue the same file.
+func (s *JsonlSink) open() error {
+	f, err := os.OpenFile(s.cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.w = bufio.NewWriter(f)
+	s.size = info.Size()
+	s.opened = time.Now()
+	return nil
+}
+
+// rotate closes the current file, renames it and opens a new one.
+func (s *JsonlSink) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(s.cfg.File)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(s.cfg.File, ext), time.Now().UTC().Format("20060102T150405.000"), ext)
+	if err := os.Rename(s.cfg.File, rotated); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+// shouldRotate returns true if the file has to be rotated before writing a line of the given size. Files always
+// get at least one line, even if it's larger than the maximum size.
+func (s *JsonlSink) shouldRotate(line int) bool {
+	if s.file == nil || s.size == 0 {
+		return false
+	}
+
+	return (s.cfg.MaxSize > 0 && s.size+int64(line) > s.cfg.MaxSize) ||
+		(s.cfg.RotateInterval > 0 && time.Since(s.opened) >= s.cfg.RotateInterval)
+}
+
+// write writes the row as a single line, rotating the file first if needed.
+func (s *JsonlSink) write(ty string, row any) error {
+	line, err := encode(ty, row)
+	if err != nil {
+		return err
+	}
+
+	if s.shouldRotate(len(line)) {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotating %s: %w", s.cfg.File, err)
+		}
+	}
+
+	n, err := s.w.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// encode encodes the row as a JSON object with the type first, followed by the fields of the row named by
+// their `ch` struct tags, and a trailing newline.
+func encode(ty string, row any) ([]byte, error) {
+	var b strings.Builder
+
+	b.WriteString(`{"type":`)
+	if err := writeValue(&b, ty); err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(row).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("ch")
+		if name == "" {
+			continue
+		}
+
+		b.WriteString(",")
+		if err := writeValue(&b, name); err != nil {
+			return nil, err
+		}
+		b.WriteString(":")
+		if err := writeValue(&b, v.Field(i).Interface()); err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", name, err)
+		}
+	}
+
+	b.WriteString("}\n")
+	return []byte(b.String()), nil
+}
+
+func writeValue(w io.Writer, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (s *JsonlSink) RecordObservationRow(row *types.ConfirmedObservationRow) error {
+	return s.write(ObservationType, row)
+}
+
+func (s *JsonlSink) RecordBlockObservationRow(row *types.BlockObservationRow) error {
+	return s.write(BlockObservationType, row)
+}
+
+func (s *JsonlSink) RecordStats(stats *types.ObservationStatsRow) error {
+	return s.write(StatsType, stats)
+}
+
+func (s *JsonlSink) RecordBlockStats(stats *types.ObservationStatsRow) error {
+	return s.write(BlockStatsType, stats)
+}
+
+func (s *JsonlSink) RecordRunMetadata(metadata *types.RunMetadata) error {
+	return s.write(RunMetadataType, metadata)
+}
+
+// Flush writes the buffered lines to the file or stdout.
+func (s *JsonlSink) Flush(_ context.Context) error {
+	return s.w.Flush()
+}
+
+func (s *JsonlSink) closeFile() error {
+	if err := s.w.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+
+	return s.file.Close()
+}
+
+// Close flushes the buffered lines and closes the file. Stdout is only flushed.
+func (s *JsonlSink) Close() error {
+	if s.file == nil {
+		return s.w.Flush()
+	}
+
+	return s.closeFile()
+}
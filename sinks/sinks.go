@@ -1,5 +1,11 @@
 package sinks
 
+import (
+	"context"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
 // InitType is used to specify which tables to create for the sink
 type InitType string
 
@@ -7,3 +13,15 @@ const (
 	Transactions InitType = "transactions"
 	Blocks       InitType = "blocks"
 )
+
+type Sink interface {
+	RecordBlockObservationRow(result *types.BlockObservationRow) error
+	RecordObservationRow(result *types.ConfirmedObservationRow) error
+	RecordStats(stats *types.ObservationStatsRow) error
+	RecordBlockStats(stats *types.ObservationStatsRow) error
+	// RecordRunMetadata is called when the benchmark starts and again when it's done.
+	RecordRunMetadata(metadata *types.RunMetadata) error
+	// Flush persists the recorded rows. Canceling the context aborts pending writes.
+	Flush(ctx context.Context) error
+	Close() error
+}
@@ -1,22 +1,36 @@
 package bloxroute
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/gorilla/websocket"
 
+	"github.com/chainbound/fiber-benchmarks/sources"
 	"github.com/chainbound/fiber-benchmarks/types"
 )
 
 type BloxrouteSource struct {
+	sources.HealthTracker
+
+	name     string
 	endpoint string
 	key      string
 	dialer   *websocket.Dialer
 
+	// Connection for sending transactions, opened on connect or the first send
+	sendConn *websocket.Conn
+	sendLock sync.Mutex
+
 	done chan struct{}
 }
 
@@ -34,6 +48,9 @@ type Transaction struct {
 		From  string
 		To    string
 	}
+
+	// Timestamp in microseconds at which the first websocket frame of the message was read
+	ReceivedAt int64 `json:"-"`
 }
 
 // A bloxroute block
@@ -41,53 +58,183 @@ type Block struct {
 	Hash         common.Hash
 	Header       any
 	Transactions []any
+
+	// Timestamp in microseconds at which the first websocket frame of the message was read
+	ReceivedAt int64 `json:"-"`
+}
+
+func init() {
+	sources.Register("bloxroute", func(config sources.Config) (sources.Source, error) {
+		if config.Endpoint() == "" {
+			return nil, fmt.Errorf("bloxroute: endpoint is required")
+		}
+
+		// One of 'ws' (default), 'grpc'
+		var transport string
+		var insecure bool
+		if err := config.Option("transport", &transport); err != nil {
+			return nil, err
+		}
+		if err := config.Option("insecure", &insecure); err != nil {
+			return nil, err
+		}
+
+		switch transport {
+		case "", "ws":
+			source := NewBloxrouteSource(config.Endpoint(), config.Key)
+			source.name = config.Name
+			return source, nil
+		case "grpc":
+			source := NewGrpcSource(config.Endpoint(), config.Key, insecure)
+			source.name = config.Name
+			return source, nil
+		default:
+			return nil, fmt.Errorf("bloxroute: invalid transport: %s", transport)
+		}
+	})
 }
 
 func NewBloxrouteSource(endpoint, apiKey string) *BloxrouteSource {
 	return &BloxrouteSource{
+		name:     "bloxroute",
 		endpoint: endpoint,
 		key:      apiKey,
 		dialer:   websocket.DefaultDialer,
+		done:     make(chan struct{}),
 	}
 }
 
-// Subscribe to new transactions.
-func (b *BloxrouteSource) SubscribeTransactions() (chan *Transaction, error) {
-	ch := make(chan *Transaction)
-	subReq := `{"id": 1, "method": "subscribe", "params": ["newTxs", {"include": ["tx_hash", "tx_contents"]}]}`
+func (b *BloxrouteSource) Name() string {
+	return b.name
+}
+
+func (b *BloxrouteSource) Capabilities() []sources.Capability {
+	return []sources.Capability{sources.Transactions, sources.Blocks}
+}
+
+// Connect opens the connection that transactions are sent on, which checks the endpoint and the key.
+// Subscriptions open their own connections.
+func (b *BloxrouteSource) Connect(ctx context.Context) error {
+	b.sendLock.Lock()
+	defer b.sendLock.Unlock()
+
+	if err := b.connectSender(ctx); err != nil {
+		b.Failed(err)
+		return err
+	}
 
-	sub, _, err := b.dialer.Dial(b.endpoint, http.Header{"Authorization": []string{b.key}})
+	b.SetConnected(true)
+	return nil
+}
+
+func (b *BloxrouteSource) connectSender(ctx context.Context) error {
+	if b.sendConn != nil {
+		return nil
+	}
+
+	conn, _, err := b.dialer.DialContext(ctx, b.endpoint, http.Header{"Authorization": []string{b.key}})
+	if err != nil {
+		return err
+	}
+
+	b.sendConn = conn
+	return nil
+}
+
+// subscribe opens a connection with a subscription. The connection is closed once the context is canceled
+// or the source is closed.
+func (b *BloxrouteSource) subscribe(ctx context.Context, subReq string) (*websocket.Conn, error) {
+	sub, _, err := b.dialer.DialContext(ctx, b.endpoint, http.Header{"Authorization": []string{b.key}})
 	if err != nil {
 		return nil, err
 	}
 
 	err = sub.WriteMessage(websocket.TextMessage, []byte(subReq))
 	if err != nil {
+		sub.Close()
 		return nil, err
 	}
 
 	// Read the first (confirmation) message
 	_, _, err = sub.ReadMessage()
 	if err != nil {
+		sub.Close()
 		return nil, err
 	}
 
 	go func() {
+		select {
+		case <-ctx.Done():
+		case <-b.done:
+		}
+		sub.Close()
+	}()
+
+	return sub, nil
+}
+
+// stopped returns true once the context is canceled or the source is closed.
+func (b *BloxrouteSource) stopped(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// readMessage reads the next message from the websocket connection. The returned timestamp (in microseconds)
+// is taken as soon as the first frame of the message is read, before the rest of the message is read or decoded.
+func readMessage(conn *websocket.Conn) ([]byte, int64, error) {
+	_, r, err := conn.NextReader()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	receivedAt := time.Now().UnixMicro()
+
+	msg, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return msg, receivedAt, nil
+}
+
+// Subscribe to new transactions.
+func (b *BloxrouteSource) SubscribeTransactions(ctx context.Context) (chan *Transaction, error) {
+	ch := make(chan *Transaction)
+	subReq := `{"id": 1, "method": "subscribe", "params": ["newTxs", {"include": ["tx_hash", "tx_contents"]}]}`
+
+	sub, err := b.subscribe(ctx, subReq)
+	if err != nil {
+		b.Failed(err)
+		b.SetConnected(false)
+		return nil, err
+	}
+
+	// Also marks the source as connected again if it's resubscribed after an error
+	b.SetConnected(true)
+
+	go func() {
+		defer close(ch)
+
 		for {
-			select {
-			case <-b.done:
-				// We're done, close the websocket connection and return
-				close(ch)
-				sub.Close()
+			var decoded blxrResponse[Transaction]
+			msg, receivedAt, err := readMessage(sub)
+			if b.stopped(ctx) {
+				// We're done, the websocket connection is closed
 				return
-			default:
 			}
 
-			var decoded blxrResponse[Transaction]
-			_, msg, err := sub.ReadMessage()
 			if err != nil {
+				// The connection can't be read from after an error
 				log.Println(err)
-				continue
+				b.Failed(err)
+				b.SetConnected(false)
+				return
 			}
 
 			if err := json.Unmarshal(msg, &decoded); err != nil {
@@ -95,6 +242,7 @@ func (b *BloxrouteSource) SubscribeTransactions() (chan *Transaction, error) {
 				continue
 			}
 
+			decoded.Params.Result.ReceivedAt = receivedAt
 			ch <- &decoded.Params.Result
 		}
 	}()
@@ -103,12 +251,12 @@ func (b *BloxrouteSource) SubscribeTransactions() (chan *Transaction, error) {
 }
 
 // Subscribe to new transaction hashes.
-func (b *BloxrouteSource) SubscribeTransactionObservations() chan types.Observation {
+func (b *BloxrouteSource) SubscribeTransactionObservations(ctx context.Context) (chan types.Observation, error) {
 	hashCh := make(chan types.Observation, types.OBSERVATION_BUFFER_SIZE)
 
-	ch, err := b.SubscribeTransactions()
+	ch, err := b.SubscribeTransactions(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	go func() {
@@ -116,54 +264,53 @@ func (b *BloxrouteSource) SubscribeTransactionObservations() chan types.Observat
 			calldata := common.Hex2Bytes(tx.TxContents.Input)
 
 			hashCh <- types.Observation{
-				Hash:         tx.TxHash,
-				Timestamp:    time.Now().UnixMicro(),
-				CallDataSize: int64(len(calldata)),
-				From:         tx.TxContents.From,
-				To:           tx.TxContents.To,
+				Hash:          tx.TxHash,
+				WireTimestamp: tx.ReceivedAt,
+				Timestamp:     time.Now().UnixMicro(),
+				CallDataSize:  int64(len(calldata)),
+				From:          tx.TxContents.From,
+				To:            tx.TxContents.To,
 			}
+			b.Observed()
 		}
+
+		close(hashCh)
 	}()
 
-	return hashCh
+	return hashCh, nil
 }
 
-func (b *BloxrouteSource) SubscribeExecutionPayloads() (chan *Block, error) {
+func (b *BloxrouteSource) SubscribeExecutionPayloads(ctx context.Context) (chan *Block, error) {
 	ch := make(chan *Block)
 	subReq := `{"id": 1, "method": "subscribe", "params": ["bdnBlocks", {"include": ["hash", "header", "transactions"]}]}`
 
-	sub, _, err := b.dialer.Dial(b.endpoint, http.Header{"Authorization": []string{b.key}})
-	if err != nil {
-		return nil, err
-	}
-
-	err = sub.WriteMessage(websocket.TextMessage, []byte(subReq))
+	sub, err := b.subscribe(ctx, subReq)
 	if err != nil {
+		b.Failed(err)
+		b.SetConnected(false)
 		return nil, err
 	}
 
-	// Read the first (confirmation) message
-	_, _, err = sub.ReadMessage()
-	if err != nil {
-		return nil, err
-	}
+	// Also marks the source as connected again if it's resubscribed after an error
+	b.SetConnected(true)
 
 	go func() {
+		defer close(ch)
+
 		for {
-			select {
-			case <-b.done:
-				// We're done, close the websocket connection and return
-				close(ch)
-				sub.Close()
+			var decoded blxrResponse[Block]
+			msg, receivedAt, err := readMessage(sub)
+			if b.stopped(ctx) {
+				// We're done, the websocket connection is closed
 				return
-			default:
 			}
 
-			var decoded blxrResponse[Block]
-			_, msg, err := sub.ReadMessage()
 			if err != nil {
+				// The connection can't be read from after an error
 				log.Println(err)
-				continue
+				b.Failed(err)
+				b.SetConnected(false)
+				return
 			}
 
 			if err := json.Unmarshal(msg, &decoded); err != nil {
@@ -171,6 +318,7 @@ func (b *BloxrouteSource) SubscribeExecutionPayloads() (chan *Block, error) {
 				continue
 			}
 
+			decoded.Params.Result.ReceivedAt = receivedAt
 			ch <- &decoded.Params.Result
 		}
 	}()
@@ -178,30 +326,88 @@ func (b *BloxrouteSource) SubscribeExecutionPayloads() (chan *Block, error) {
 	return ch, nil
 }
 
-func (b *BloxrouteSource) SubscribeBlockObservations() chan types.BlockObservation {
+func (b *BloxrouteSource) SubscribeBlockObservations(ctx context.Context) (chan types.BlockObservation, error) {
 	hashCh := make(chan types.BlockObservation, 16)
 
-	ch, err := b.SubscribeExecutionPayloads()
+	ch, err := b.SubscribeExecutionPayloads(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	go func() {
 		for block := range ch {
 			hashCh <- types.BlockObservation{
 				Hash:            block.Hash,
+				WireTimestamp:   block.ReceivedAt,
 				Timestamp:       time.Now().UnixMicro(),
 				TransactionsLen: len(block.Transactions),
 			}
+			b.Observed()
 		}
 
 		close(hashCh)
 	}()
 
-	return hashCh
+	return hashCh, nil
+}
+
+type blxrTxResponse struct {
+	Result struct {
+		TxHash string
+	}
+	Error *struct {
+		Code    int
+		Message string
+	}
+}
+
+// SendTransaction sends a signed transaction with the blxr_tx method.
+func (b *BloxrouteSource) SendTransaction(ctx context.Context, tx *ethtypes.Transaction) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	b.sendLock.Lock()
+	defer b.sendLock.Unlock()
+
+	if err := b.connectSender(ctx); err != nil {
+		return err
+	}
+
+	req := fmt.Sprintf(`{"id": 1, "method": "blxr_tx", "params": {"transaction": "%s"}}`, hex.EncodeToString(raw))
+
+	var resp blxrTxResponse
+	err = b.sendConn.WriteMessage(websocket.TextMessage, []byte(req))
+	if err == nil {
+		err = b.sendConn.ReadJSON(&resp)
+	}
+
+	if err != nil {
+		// Reconnect on the next send
+		b.sendConn.Close()
+		b.sendConn = nil
+		return err
+	}
+
+	if resp.Error != nil {
+		return fmt.Errorf("blxr_tx: %s (%d)", resp.Error.Message, resp.Error.Code)
+	}
+
+	return nil
 }
 
 // Closes the WebSocket connection and all open subscriptions
-func (b *BloxrouteSource) Close() {
+func (b *BloxrouteSource) Close() error {
+	b.SetConnected(false)
 	close(b.done)
+
+	b.sendLock.Lock()
+	defer b.sendLock.Unlock()
+
+	if b.sendConn != nil {
+		return b.sendConn.Close()
+	}
+
+	return nil
 }
@@ -0,0 +1,347 @@
+package bloxroute
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/chainbound/fiber-benchmarks/sources"
+	"github.com/chainbound/fiber-benchmarks/sources/rawgrpc"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// Methods and field numbers of the gateway gRPC API (gateway.proto in bloXroute-Labs/gateway).
+// Messages are decoded by hand, so only the fields we need are declared here.
+const (
+	newTxsMethod    = "/gateway.Gateway/NewTxs"
+	bdnBlocksMethod = "/gateway.Gateway/BdnBlocks"
+
+	// TxsReply
+	txsReplyTx protowire.Number = 1
+	// Tx
+	txFrom  protowire.Number = 1
+	txRawTx protowire.Number = 4
+	// BlocksReply
+	blocksReplyHash         protowire.Number = 1
+	blocksReplyTransactions protowire.Number = 4
+)
+
+// GrpcSource streams transactions and blocks from the gRPC API of a bloXroute gateway. It avoids the JSON
+// encoding of the websocket API, so it doesn't bias the comparison towards Fiber.
+type GrpcSource struct {
+	sources.HealthTracker
+
+	name     string
+	endpoint string
+	key      string
+	insecure bool
+
+	conn *grpc.ClientConn
+	done chan struct{}
+}
+
+// A transaction from the gRPC API
+type GrpcTransaction struct {
+	From common.Address
+	Tx   *ethtypes.Transaction
+
+	// Timestamp in microseconds at which the message was received, before it was decoded
+	ReceivedAt int64
+}
+
+// A block from the gRPC API
+type GrpcBlock struct {
+	Hash            common.Hash
+	TransactionsLen int
+
+	// Timestamp in microseconds at which the message was received, before it was decoded
+	ReceivedAt int64
+}
+
+// NewGrpcSource returns a source for the gateway at endpoint (host:port). Connections use TLS unless
+// insecure is set, which is useful for a local gateway.
+func NewGrpcSource(endpoint, apiKey string, insecure bool) *GrpcSource {
+	return &GrpcSource{
+		name:     "bloxroute",
+		endpoint: endpoint,
+		key:      apiKey,
+		insecure: insecure,
+		done:     make(chan struct{}),
+	}
+}
+
+func (b *GrpcSource) Name() string {
+	return b.name
+}
+
+func (b *GrpcSource) Capabilities() []sources.Capability {
+	return []sources.Capability{sources.Transactions, sources.Blocks}
+}
+
+func (b *GrpcSource) Connect(ctx context.Context) error {
+	creds := credentials.NewTLS(&tls.Config{})
+	if b.insecure {
+		creds = insecure.NewCredentials()
+	}
+
+	conn, err := grpc.DialContext(ctx, b.endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		b.Failed(err)
+		return err
+	}
+
+	b.conn = conn
+	b.SetConnected(true)
+	return nil
+}
+
+// subscribe opens a server stream on the method and calls handle with every message and the timestamp at
+// which it was received, until the context is canceled or the source is closed. done is called after the last message.
+func (b *GrpcSource) subscribe(ctx context.Context, method string, handle func(msg []byte, receivedAt int64), done func()) error {
+	if b.conn == nil {
+		if err := b.Connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", b.key)
+	if err := b.openStream(ctx, method, handle, done); err != nil {
+		b.Failed(err)
+		b.SetConnected(false)
+		return err
+	}
+
+	return nil
+}
+
+// openStream opens the server stream of subscribe.
+func (b *GrpcSource) openStream(ctx context.Context, method string, handle func(msg []byte, receivedAt int64), done func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	stream, err := b.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method, grpc.ForceCodec(rawgrpc.Codec{}))
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	// An empty request subscribes to everything with the default fields
+	req := []byte{}
+	if err := stream.SendMsg(&req); err != nil {
+		cancel()
+		return err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		cancel()
+		return err
+	}
+
+	// Set before reading, so a failed read isn't overwritten. Also marks the source as connected again if it's
+	// resubscribed after an error.
+	b.SetConnected(true)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-b.done:
+		}
+		cancel()
+	}()
+
+	go func() {
+		defer done()
+
+		var msg []byte
+		for {
+			if err := stream.RecvMsg(&msg); err != nil {
+				if ctx.Err() == nil {
+					log.Println(err)
+					b.Failed(err)
+					b.SetConnected(false)
+				}
+				return
+			}
+
+			handle(msg, time.Now().UnixMicro())
+		}
+	}()
+
+	return nil
+}
+
+// Subscribe to new transactions.
+func (b *GrpcSource) SubscribeTransactions(ctx context.Context) (chan *GrpcTransaction, error) {
+	ch := make(chan *GrpcTransaction)
+
+	err := b.subscribe(ctx, newTxsMethod, func(msg []byte, receivedAt int64) {
+		txs, err := decodeTxsReply(msg)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		for _, tx := range txs {
+			tx.ReceivedAt = receivedAt
+			ch <- tx
+		}
+	}, func() { close(ch) })
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// Subscribe to new transaction hashes.
+func (b *GrpcSource) SubscribeTransactionObservations(ctx context.Context) (chan types.Observation, error) {
+	hashCh := make(chan types.Observation, types.OBSERVATION_BUFFER_SIZE)
+
+	ch, err := b.SubscribeTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for tx := range ch {
+			to := ""
+			if tx.Tx.To() != nil {
+				to = tx.Tx.To().Hex()
+			}
+
+			hashCh <- types.Observation{
+				Hash:          tx.Tx.Hash(),
+				WireTimestamp: tx.ReceivedAt,
+				Timestamp:     time.Now().UnixMicro(),
+				CallDataSize:  int64(len(tx.Tx.Data())),
+				From:          tx.From.Hex(),
+				To:            to,
+			}
+			b.Observed()
+		}
+
+		close(hashCh)
+	}()
+
+	return hashCh, nil
+}
+
+func (b *GrpcSource) SubscribeExecutionPayloads(ctx context.Context) (chan *GrpcBlock, error) {
+	ch := make(chan *GrpcBlock)
+
+	err := b.subscribe(ctx, bdnBlocksMethod, func(msg []byte, receivedAt int64) {
+		block, err := decodeBlocksReply(msg)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		block.ReceivedAt = receivedAt
+		ch <- block
+	}, func() { close(ch) })
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+func (b *GrpcSource) SubscribeBlockObservations(ctx context.Context) (chan types.BlockObservation, error) {
+	hashCh := make(chan types.BlockObservation, 16)
+
+	ch, err := b.SubscribeExecutionPayloads(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for block := range ch {
+			hashCh <- types.BlockObservation{
+				Hash:            block.Hash,
+				WireTimestamp:   block.ReceivedAt,
+				Timestamp:       time.Now().UnixMicro(),
+				TransactionsLen: block.TransactionsLen,
+			}
+			b.Observed()
+		}
+
+		close(hashCh)
+	}()
+
+	return hashCh, nil
+}
+
+// Closes the gRPC connection and all open subscriptions
+func (b *GrpcSource) Close() error {
+	b.SetConnected(false)
+	close(b.done)
+	if b.conn != nil {
+		return b.conn.Close()
+	}
+
+	return nil
+}
+
+func decodeTxsReply(msg []byte) ([]*GrpcTransaction, error) {
+	var txs []*GrpcTransaction
+
+	err := rawgrpc.DecodeFields(msg, func(num protowire.Number, value []byte) error {
+		if num != txsReplyTx {
+			return nil
+		}
+
+		tx := new(GrpcTransaction)
+		err := rawgrpc.DecodeFields(value, func(num protowire.Number, value []byte) error {
+			switch num {
+			case txFrom:
+				tx.From = common.BytesToAddress(value)
+			case txRawTx:
+				tx.Tx = new(ethtypes.Transaction)
+				if err := tx.Tx.UnmarshalBinary(value); err != nil {
+					return fmt.Errorf("decoding raw transaction: %w", err)
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if tx.Tx == nil {
+			return fmt.Errorf("transaction without raw_tx")
+		}
+
+		txs = append(txs, tx)
+		return nil
+	})
+
+	return txs, err
+}
+
+func decodeBlocksReply(msg []byte) (*GrpcBlock, error) {
+	block := new(GrpcBlock)
+
+	err := rawgrpc.DecodeFields(msg, func(num protowire.Number, value []byte) error {
+		switch num {
+		case blocksReplyHash:
+			block.Hash = common.HexToHash(string(value))
+		case blocksReplyTransactions:
+			block.TransactionsLen++
+		}
+		return nil
+	})
+
+	return block, err
+}
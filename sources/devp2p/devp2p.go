@@ -0,0 +1,381 @@
+// Package devp2p implements a transaction source that joins the Ethereum p2p network as a lightweight eth/68
+// peer. It connects to a fixed set of peers and timestamps their transaction announcements and broadcasts,
+// which is the baseline that all mempool services are measured against.
+package devp2p
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+
+	"github.com/chainbound/fiber-benchmarks/sources"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+const (
+	// Transactions are deduplicated across peers for this long
+	seenRetention = 10 * time.Minute
+	// Maximum size of a message that is decoded
+	maxMessageSize = 10 * 1024 * 1024
+)
+
+type Devp2pSource struct {
+	sources.HealthTracker
+
+	name  string
+	peers []*enode.Node
+	key   *ecdsa.PrivateKey
+
+	server *p2p.Server
+
+	// Current subscription, nil if there is none
+	sub     *subscription
+	subLock sync.Mutex
+
+	// First time (in microseconds) every transaction was seen by any peer
+	seen     map[common.Hash]int64
+	seenLock sync.Mutex
+
+	// Number of peers that completed the handshake
+	connected int
+	peersLock sync.Mutex
+
+	done chan struct{}
+}
+
+// subscription is the channel that observations are sent on, until done is closed.
+type subscription struct {
+	ch   chan types.Observation
+	done <-chan struct{}
+}
+
+// NewDevp2pSource returns a source that connects to the enode URLs of the peers. The node key is a hex
+// encoded private key. If it's empty, a new key is generated.
+func NewDevp2pSource(peers []string, nodeKey string) (*Devp2pSource, error) {
+	nodes := make([]*enode.Node, 0, len(peers))
+	for _, peer := range peers {
+		node, err := enode.Parse(enode.ValidSchemes, peer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer %s: %w", peer, err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	var (
+		key *ecdsa.PrivateKey
+		err error
+	)
+	if nodeKey != "" {
+		key, err = crypto.HexToECDSA(nodeKey)
+	} else {
+		key, err = crypto.GenerateKey()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid node key: %w", err)
+	}
+
+	return &Devp2pSource{
+		name:  "devp2p",
+		peers: nodes,
+		key:   key,
+		seen:  make(map[common.Hash]int64),
+		done:  make(chan struct{}),
+	}, nil
+}
+
+func init() {
+	sources.Register("devp2p", func(config sources.Config) (sources.Source, error) {
+		if len(config.Endpoints) == 0 {
+			return nil, fmt.Errorf("devp2p: at least 1 peer is required")
+		}
+
+		source, err := NewDevp2pSource(config.Endpoints, config.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		source.name = config.Name
+		return source, nil
+	})
+}
+
+func (d *Devp2pSource) Name() string {
+	return d.name
+}
+
+func (d *Devp2pSource) Capabilities() []sources.Capability {
+	return []sources.Capability{sources.Transactions}
+}
+
+// Connect starts the p2p server. The peers are dialed as static nodes, so they are redialed if
+// they disconnect. The source counts as connected while at least one peer is.
+func (d *Devp2pSource) Connect(_ context.Context) error {
+	d.server = &p2p.Server{
+		Config: p2p.Config{
+			PrivateKey:  d.key,
+			Name:        "fiber-benchmarks",
+			MaxPeers:    len(d.peers),
+			NoDiscovery: true,
+			StaticNodes: d.peers,
+			Protocols: []p2p.Protocol{{
+				Name:    eth.ProtocolName,
+				Version: eth.ETH68,
+				Length:  17,
+				Run:     d.run,
+			}},
+		},
+	}
+
+	if err := d.server.Start(); err != nil {
+		d.Failed(err)
+		return err
+	}
+
+	go d.prune()
+
+	return nil
+}
+
+// Subscribe to new transaction hashes. Every transaction is only reported by the peer that announced or
+// broadcast it first, which is set as the source of the observation.
+func (d *Devp2pSource) SubscribeTransactionObservations(ctx context.Context) (chan types.Observation, error) {
+	if d.server == nil {
+		if err := d.Connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Replaces the previous subscription, if any
+	sub := &subscription{ch: make(chan types.Observation, types.OBSERVATION_BUFFER_SIZE), done: ctx.Done()}
+	d.subLock.Lock()
+	d.sub = sub
+	d.subLock.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-d.done:
+		}
+
+		// Observations are sent while holding the lock, so the channel isn't closed during a send
+		d.subLock.Lock()
+		defer d.subLock.Unlock()
+
+		if d.sub == sub {
+			d.sub = nil
+		}
+		close(sub.ch)
+	}()
+
+	return sub.ch, nil
+}
+
+// Stops the p2p server and disconnects from all peers
+func (d *Devp2pSource) Close() error {
+	close(d.done)
+	if d.server != nil {
+		d.server.Stop()
+	}
+
+	return nil
+}
+
+// run handles the eth protocol with a single peer until it disconnects.
+func (d *Devp2pSource) run(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+	if err := handshake(rw); err != nil {
+		err = fmt.Errorf("handshake with %s: %w", peer.ID().TerminalString(), err)
+		log.Println(err)
+		d.Failed(err)
+		return err
+	}
+
+	d.peerConnected(1)
+	defer d.peerConnected(-1)
+
+	name := peer.ID().TerminalString()
+
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+
+		receivedAt := time.Now().UnixMicro()
+
+		if msg.Size > maxMessageSize {
+			msg.Discard()
+			return fmt.Errorf("message too large: %d bytes", msg.Size)
+		}
+
+		if err := d.handle(name, rw, msg, receivedAt); err != nil {
+			return err
+		}
+	}
+}
+
+// handshake mirrors the status of the peer, so that the handshake succeeds on any network and fork
+// without following the chain.
+func handshake(rw p2p.MsgReadWriter) error {
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+
+	if msg.Code != eth.StatusMsg {
+		return fmt.Errorf("expected status message, got %d", msg.Code)
+	}
+
+	var status eth.StatusPacket
+	if err := msg.Decode(&status); err != nil {
+		return err
+	}
+
+	return p2p.Send(rw, eth.StatusMsg, &status)
+}
+
+func (d *Devp2pSource) handle(peer string, rw p2p.MsgReadWriter, msg p2p.Msg, receivedAt int64) error {
+	defer msg.Discard()
+
+	switch msg.Code {
+	case eth.NewPooledTransactionHashesMsg:
+		var ann eth.NewPooledTransactionHashesPacket
+		if err := msg.Decode(&ann); err != nil {
+			return err
+		}
+
+		for _, hash := range ann.Hashes {
+			d.observe(types.Observation{Hash: hash, WireTimestamp: receivedAt}, peer)
+		}
+
+	case eth.TransactionsMsg:
+		var txs eth.TransactionsPacket
+		if err := msg.Decode(&txs); err != nil {
+			return err
+		}
+
+		for _, tx := range txs {
+			obs := types.Observation{
+				Hash:          tx.Hash(),
+				WireTimestamp: receivedAt,
+				CallDataSize:  int64(len(tx.Data())),
+			}
+
+			if tx.To() != nil {
+				obs.To = tx.To().Hex()
+			}
+
+			if from, err := ethtypes.Sender(ethtypes.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+				obs.From = from.Hex()
+			}
+
+			d.observe(obs, peer)
+		}
+
+	// We don't serve the chain or the transaction pool, but answer requests with empty responses
+	// so that the peer doesn't time out and disconnect
+	case eth.GetBlockHeadersMsg:
+		return replyEmpty[eth.GetBlockHeadersPacket](rw, msg, eth.BlockHeadersMsg, func(req eth.GetBlockHeadersPacket) any {
+			return &eth.BlockHeadersPacket{RequestId: req.RequestId}
+		})
+	case eth.GetBlockBodiesMsg:
+		return replyEmpty[eth.GetBlockBodiesPacket](rw, msg, eth.BlockBodiesMsg, func(req eth.GetBlockBodiesPacket) any {
+			return &eth.BlockBodiesPacket{RequestId: req.RequestId}
+		})
+	case eth.GetReceiptsMsg:
+		return replyEmpty[eth.GetReceiptsPacket](rw, msg, eth.ReceiptsMsg, func(req eth.GetReceiptsPacket) any {
+			return &eth.ReceiptsPacket{RequestId: req.RequestId}
+		})
+	case eth.GetPooledTransactionsMsg:
+		return replyEmpty[eth.GetPooledTransactionsPacket](rw, msg, eth.PooledTransactionsMsg, func(req eth.GetPooledTransactionsPacket) any {
+			return &eth.PooledTransactionsPacket{RequestId: req.RequestId}
+		})
+	}
+
+	return nil
+}
+
+// replyEmpty decodes a request and sends the response built by respond.
+func replyEmpty[T any](rw p2p.MsgReadWriter, msg p2p.Msg, code uint64, respond func(T) any) error {
+	var req T
+	if err := msg.Decode(&req); err != nil {
+		return err
+	}
+
+	return p2p.Send(rw, code, respond(req))
+}
+
+// observe reports the transaction if no other peer has seen it before.
+func (d *Devp2pSource) observe(obs types.Observation, peer string) {
+	d.seenLock.Lock()
+	_, seen := d.seen[obs.Hash]
+	if !seen {
+		d.seen[obs.Hash] = obs.WireTimestamp
+	}
+	d.seenLock.Unlock()
+
+	if seen {
+		return
+	}
+
+	obs.Timestamp = time.Now().UnixMicro()
+	obs.Source = peer
+	d.Observed()
+
+	d.subLock.Lock()
+	defer d.subLock.Unlock()
+
+	// Nobody to report to
+	if d.sub == nil {
+		return
+	}
+
+	// Blocks the peer while the subscriber is busy, but not once it stopped or the source is closed
+	select {
+	case d.sub.ch <- obs:
+	case <-d.sub.done:
+	case <-d.done:
+	}
+}
+
+// peerConnected updates the number of connected peers by delta.
+func (d *Devp2pSource) peerConnected(delta int) {
+	d.peersLock.Lock()
+	defer d.peersLock.Unlock()
+
+	d.connected += delta
+	d.SetConnected(d.connected > 0)
+}
+
+// prune removes transactions that were first seen longer than the retention ago.
+func (d *Devp2pSource) prune() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			cutoff := time.Now().Add(-seenRetention).UnixMicro()
+
+			d.seenLock.Lock()
+			for hash, ts := range d.seen {
+				if ts < cutoff {
+					delete(d.seen, hash)
+				}
+			}
+			d.seenLock.Unlock()
+		}
+	}
+}
@@ -2,16 +2,43 @@ package fiber
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"time"
 
+	"github.com/chainbound/fiber-benchmarks/sources"
 	"github.com/chainbound/fiber-benchmarks/types"
 	fiber "github.com/chainbound/fiber-go"
 	"github.com/chainbound/fiber-go/filter"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"google.golang.org/grpc"
 )
 
 type FiberSource struct {
+	sources.HealthTracker
+
+	name   string
 	client FiberInnerSource
-	done   chan struct{}
+	// The endpoint this source is connected to. Empty when multiplexing.
+	endpoint string
+	done     chan struct{}
+
+	// Observations are read from gRPC streams on these connections, one per endpoint
+	endpoints []string
+	key       string
+	conns     []*grpc.ClientConn
+}
+
+func init() {
+	sources.Register("fiber", func(config sources.Config) (sources.Source, error) {
+		if len(config.Endpoints) == 0 {
+			return nil, fmt.Errorf("fiber: at least 1 endpoint is required")
+		}
+
+		source := NewFiberSource(config.Endpoints, config.Key)
+		source.name = config.Name
+		return source, nil
+	})
 }
 
 type FiberInnerSource interface {
@@ -19,6 +46,7 @@ type FiberInnerSource interface {
 	Close() error
 	SubscribeNewTxs(filter *filter.Filter, ch chan<- *fiber.TransactionWithSender) error
 	SubscribeNewExecutionPayloads(ch chan<- *fiber.Block) error
+	SendTransaction(ctx context.Context, tx *ethtypes.Transaction) (string, int64, error)
 }
 
 func NewFiberSource(endpoints []string, apiKey string) *FiberSource {
@@ -29,110 +57,209 @@ func NewFiberSource(endpoints []string, apiKey string) *FiberSource {
 		client = fiber.NewClient(endpoints[0], apiKey)
 	}
 	return &FiberSource{
-		client: client,
-		done:   make(chan struct{}),
+		name:      "fiber",
+		client:    client,
+		done:      make(chan struct{}),
+		endpoints: endpoints,
+		key:       apiKey,
 	}
 }
 
-func (f *FiberSource) Connect() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// NewEndpointSources returns a separate source for every endpoint instead of a single multiplexed one,
+// so that observations can be attributed to the endpoint that delivered them.
+func NewEndpointSources(endpoints []string, apiKey string) []*FiberSource {
+	endpointSources := make([]*FiberSource, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		endpointSources = append(endpointSources, &FiberSource{
+			name:      endpoint,
+			client:    fiber.NewClient(endpoint, apiKey),
+			endpoint:  endpoint,
+			done:      make(chan struct{}),
+			endpoints: []string{endpoint},
+			key:       apiKey,
+		})
+	}
+
+	return endpointSources
+}
+
+func (f *FiberSource) Name() string {
+	return f.name
+}
+
+func (f *FiberSource) Capabilities() []sources.Capability {
+	return []sources.Capability{sources.Transactions, sources.Blocks}
+}
+
+// Endpoint returns the endpoint of this source, or an empty string if it's multiplexed.
+func (f *FiberSource) Endpoint() string {
+	return f.endpoint
+}
+
+func (f *FiberSource) Connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	if err := f.client.Connect(ctx); err != nil {
+		f.Failed(err)
 		return err
 	}
 
+	if err := f.dial(ctx); err != nil {
+		f.Failed(err)
+		return err
+	}
+
+	f.SetConnected(true)
 	return nil
 }
 
 // Subscribe to new transactions. This function returns a channel of transactions that will
-// close once `Close` gets called.
+// close once the subscription ends, e.g. because `Close` gets called. Errors are reported in the health.
 func (f *FiberSource) SubscribeTransactions() chan *fiber.TransactionWithSender {
 	ch := make(chan *fiber.TransactionWithSender)
 
 	go func() {
-		go func() {
-			if err := f.client.SubscribeNewTxs(nil, ch); err != nil {
-				panic(err)
-			}
-		}()
-
-		<-f.done
-		close(ch)
+		defer close(ch)
+		f.ended(f.client.SubscribeNewTxs(nil, ch))
 	}()
 
 	return ch
 }
 
-// Subscribe to new transactio hashes. This function returns a BUFFERED channel of transaction hashes that will
-// close once `Close` gets called.
-func (f *FiberSource) SubscribeTransactionObservations() chan types.Observation {
+// Subscribe to new transaction hashes. This function returns a BUFFERED channel of transaction hashes that will
+// close once `Close` gets called or the context is canceled.
+func (f *FiberSource) SubscribeTransactionObservations(ctx context.Context) (chan types.Observation, error) {
 	hashCh := make(chan types.Observation, types.OBSERVATION_BUFFER_SIZE)
 
-	go func() {
-		ch := f.SubscribeTransactions()
-
-		for tx := range ch {
-			to := ""
-			if tx.Transaction.To() != nil {
-				to = tx.Transaction.To().Hex()
-			}
-
-			hashCh <- types.Observation{
-				Hash:         tx.Transaction.Hash(),
-				Timestamp:    time.Now().UnixMicro(),
-				CallDataSize: int64(len(tx.Transaction.Data())),
-				From:         tx.Sender.Hex(),
-				To:           to,
-			}
+	// The multiplexed client forwards the first of the duplicates from different endpoints only, and so do we
+	var seen *seenHashes
+	if len(f.endpoints) > 1 {
+		seen = newSeenHashes(seenSize)
+	}
+
+	err := f.subscribe(ctx, newTxsMethod, func(msg []byte, receivedAt int64) {
+		tx, err := decodeTransaction(msg)
+		if err != nil {
+			log.Println(err)
+			return
 		}
 
-		close(hashCh)
-	}()
+		if seen != nil && !seen.add(tx.Tx.Hash()) {
+			return
+		}
+
+		to := ""
+		if tx.Tx.To() != nil {
+			to = tx.Tx.To().Hex()
+		}
 
-	return hashCh
+		observation := types.Observation{
+			Hash:          tx.Tx.Hash(),
+			WireTimestamp: receivedAt,
+			CallDataSize:  int64(len(tx.Tx.Data())),
+			From:          tx.From.Hex(),
+			To:            to,
+			Source:        f.endpoint,
+			// Evaluated last, after all decoding above
+			Timestamp: time.Now().UnixMicro(),
+		}
+
+		select {
+		case hashCh <- observation:
+			f.Observed()
+		case <-ctx.Done():
+		}
+	}, func() { close(hashCh) })
+
+	if err != nil {
+		return nil, err
+	}
+
+	return hashCh, nil
 }
 
-// Subscribe to new execution payloads. This function returns a channel of transactions that will
-// close once `Close` gets called.
+// Subscribe to new execution payloads. This function returns a channel of payloads that will
+// close once the subscription ends, e.g. because `Close` gets called. Errors are reported in the health.
 func (f *FiberSource) SubscribeExecutionPayloads() chan *fiber.Block {
 	ch := make(chan *fiber.Block)
 
 	go func() {
-		go func() {
-			if err := f.client.SubscribeNewExecutionPayloads(ch); err != nil {
-				panic(err)
-			}
-		}()
-
-		<-f.done
-		close(ch)
+		defer close(ch)
+		f.ended(f.client.SubscribeNewExecutionPayloads(ch))
 	}()
 
 	return ch
 }
 
-func (f *FiberSource) SubscribeBlockObservations() chan types.BlockObservation {
+// ended records why a subscription ended. Subscriptions end with an error once the client is closed,
+// which is expected.
+func (f *FiberSource) ended(err error) {
+	select {
+	case <-f.done:
+		return
+	default:
+	}
+
+	if err == nil {
+		err = fmt.Errorf("subscription ended")
+	}
+
+	f.Failed(err)
+	f.SetConnected(false)
+}
+
+func (f *FiberSource) SubscribeBlockObservations(ctx context.Context) (chan types.BlockObservation, error) {
 	obsCh := make(chan types.BlockObservation, 16)
 
-	go func() {
-		ch := f.SubscribeExecutionPayloads()
-
-		for block := range ch {
-			obsCh <- types.BlockObservation{
-				Hash:            block.Header.Hash(),
-				Timestamp:       time.Now().UnixMicro(),
-				TransactionsLen: len(block.Transactions),
-			}
+	// Every endpoint streams the same payloads
+	var seen *seenHashes
+	if len(f.endpoints) > 1 {
+		seen = newSeenHashes(seenSize)
+	}
+
+	err := f.subscribe(ctx, executionPayloadsMethod, func(msg []byte, receivedAt int64) {
+		payload, err := decodePayload(msg)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		if seen != nil && !seen.add(payload.Hash) {
+			return
 		}
 
-		close(obsCh)
+		observation := types.BlockObservation{
+			Hash:            payload.Hash,
+			WireTimestamp:   receivedAt,
+			TransactionsLen: payload.TransactionsLen,
+			Timestamp:       time.Now().UnixMicro(),
+		}
 
-	}()
+		select {
+		case obsCh <- observation:
+			f.Observed()
+		case <-ctx.Done():
+		}
+	}, func() { close(obsCh) })
+
+	if err != nil {
+		return nil, err
+	}
 
-	return obsCh
+	return obsCh, nil
+}
+
+// SendTransaction sends a signed transaction through Fiber.
+func (f *FiberSource) SendTransaction(ctx context.Context, tx *ethtypes.Transaction) error {
+	_, _, err := f.client.SendTransaction(ctx, tx)
+	return err
 }
 
 func (f *FiberSource) Close() error {
+	f.SetConnected(false)
 	close(f.done)
+	for _, conn := range f.conns {
+		conn.Close()
+	}
 	return f.client.Close()
 }
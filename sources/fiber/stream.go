@@ -0,0 +1,262 @@
+package fiber
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/chainbound/fiber-benchmarks/sources/rawgrpc"
+)
+
+// Methods and field numbers of the Fiber gRPC API (api.proto in chainbound/fiber-proto). fiber-go decodes
+// messages before handing them over, so observations are read from the streams directly. Messages are decoded
+// by hand, so only the fields we need are declared here.
+const (
+	newTxsMethod            = "/api.API/SubscribeNewTxsV2"
+	executionPayloadsMethod = "/api.API/SubscribeExecutionPayloadsV2"
+
+	// TransactionWithSenderMsg
+	txRlpTransaction protowire.Number = 1
+	txSender         protowire.Number = 2
+	// ExecutionPayloadMsg
+	payloadSszPayload protowire.Number = 2
+)
+
+// Offsets in the SSZ encoding of an execution payload, which are the same since Bellatrix.
+const (
+	extraDataOffset    = 436
+	blockHashOffset    = 472
+	transactionsOffset = 504
+	withdrawalsOffset  = 508
+	// Size of the fixed part of a Bellatrix payload. Later forks add the withdrawals offset after it.
+	bellatrixFixedSize = 508
+)
+
+// Number of hashes remembered to deduplicate the transactions of multiplexed streams
+const seenSize = 1 << 16
+
+// A transaction read from the stream
+type streamTransaction struct {
+	From common.Address
+	Tx   *ethtypes.Transaction
+}
+
+// An execution payload read from the stream
+type streamPayload struct {
+	Hash            common.Hash
+	TransactionsLen int
+}
+
+// dial opens a connection to every endpoint. Streams are opened on them when subscribing.
+func (f *FiberSource) dial(ctx context.Context) error {
+	if f.conns != nil {
+		return nil
+	}
+
+	for _, endpoint := range f.endpoints {
+		conn, err := grpc.DialContext(ctx, endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return fmt.Errorf("dialing %s: %w", endpoint, err)
+		}
+
+		f.conns = append(f.conns, conn)
+	}
+
+	return nil
+}
+
+// subscribe opens a server stream on the method at every endpoint and calls handle with every message and the
+// timestamp at which it was received, before it's decoded. handle is called concurrently if there are multiple
+// endpoints. done is called after the last message of all streams.
+func (f *FiberSource) subscribe(ctx context.Context, method string, handle func(msg []byte, receivedAt int64), done func()) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", f.key)
+	ctx, cancel := context.WithCancel(ctx)
+
+	streams := make([]grpc.ClientStream, 0, len(f.conns))
+	for _, conn := range f.conns {
+		stream, err := openStream(ctx, conn, method)
+		if err != nil {
+			cancel()
+			f.Failed(err)
+			f.SetConnected(false)
+			return err
+		}
+
+		streams = append(streams, stream)
+	}
+
+	// Set before reading, so a failed read isn't overwritten
+	f.SetConnected(true)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-f.done:
+		}
+		cancel()
+	}()
+
+	var wg sync.WaitGroup
+	for _, stream := range streams {
+		wg.Add(1)
+		go func(stream grpc.ClientStream) {
+			defer wg.Done()
+
+			var msg []byte
+			for {
+				if err := stream.RecvMsg(&msg); err != nil {
+					if ctx.Err() == nil {
+						log.Println(err)
+						f.ended(err)
+					}
+					return
+				}
+
+				handle(msg, time.Now().UnixMicro())
+			}
+		}(stream)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		done()
+	}()
+
+	return nil
+}
+
+func openStream(ctx context.Context, conn *grpc.ClientConn, method string) (grpc.ClientStream, error) {
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method, grpc.ForceCodec(rawgrpc.Codec{}))
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty filter subscribes to all transactions, and an empty message is all the payload stream takes
+	req := []byte{}
+	if err := stream.SendMsg(&req); err != nil {
+		return nil, err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+func decodeTransaction(msg []byte) (*streamTransaction, error) {
+	tx := new(streamTransaction)
+
+	err := rawgrpc.DecodeFields(msg, func(num protowire.Number, value []byte) error {
+		switch num {
+		case txSender:
+			tx.From = common.BytesToAddress(value)
+		case txRlpTransaction:
+			tx.Tx = new(ethtypes.Transaction)
+			if err := tx.Tx.UnmarshalBinary(value); err != nil {
+				return fmt.Errorf("decoding transaction: %w", err)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tx.Tx == nil {
+		return nil, fmt.Errorf("transaction without rlp_transaction")
+	}
+
+	return tx, nil
+}
+
+func decodePayload(msg []byte) (*streamPayload, error) {
+	var ssz []byte
+	err := rawgrpc.DecodeFields(msg, func(num protowire.Number, value []byte) error {
+		if num == payloadSszPayload {
+			ssz = value
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePayloadSSZ(ssz)
+}
+
+// decodePayloadSSZ reads the block hash and the number of transactions of an SSZ encoded execution payload,
+// without decoding the rest.
+func decodePayloadSSZ(ssz []byte) (*streamPayload, error) {
+	if len(ssz) < bellatrixFixedSize {
+		return nil, fmt.Errorf("execution payload too short: %d bytes", len(ssz))
+	}
+
+	// The first variable-size field starts right after the fixed part, which tells the fork apart
+	fixedSize := binary.LittleEndian.Uint32(ssz[extraDataOffset:])
+	start := binary.LittleEndian.Uint32(ssz[transactionsOffset:])
+	end := uint32(len(ssz))
+	if fixedSize > bellatrixFixedSize {
+		end = binary.LittleEndian.Uint32(ssz[withdrawalsOffset:])
+	}
+
+	if start > end || end > uint32(len(ssz)) {
+		return nil, fmt.Errorf("invalid transactions offsets %d-%d", start, end)
+	}
+
+	payload := &streamPayload{Hash: common.BytesToHash(ssz[blockHashOffset : blockHashOffset+common.HashLength])}
+
+	// A list of variable-size items starts with the offsets of all items, so the first offset tells their number
+	if end-start >= 4 {
+		payload.TransactionsLen = int(binary.LittleEndian.Uint32(ssz[start:]) / 4)
+	}
+
+	return payload, nil
+}
+
+// seenHashes remembers recent hashes to deduplicate multiplexed streams. It keeps two generations of at most
+// size hashes, so memory stays bounded.
+type seenHashes struct {
+	lock     sync.Mutex
+	size     int
+	current  map[common.Hash]struct{}
+	previous map[common.Hash]struct{}
+}
+
+func newSeenHashes(size int) *seenHashes {
+	return &seenHashes{size: size, current: make(map[common.Hash]struct{})}
+}
+
+// add returns whether the hash is new, and remembers it.
+func (s *seenHashes) add(hash common.Hash) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.current[hash]; ok {
+		return false
+	}
+	if _, ok := s.previous[hash]; ok {
+		return false
+	}
+
+	if len(s.current) >= s.size {
+		s.previous = s.current
+		s.current = make(map[common.Hash]struct{})
+	}
+
+	s.current[hash] = struct{}{}
+	return true
+}
@@ -0,0 +1,445 @@
+// Package jsonrpc implements a transaction source for providers that push pending transactions with a
+// JSON-RPC subscription over websockets, like eth_subscribe on most node providers. The payload shape is
+// configurable, so new providers can be added without code changes.
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+
+	"github.com/chainbound/fiber-benchmarks/sources"
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+const (
+	DefaultName   = "jsonrpc"
+	DefaultMethod = "eth_subscribe"
+
+	// Maximum number of concurrent requests to fetch transaction details
+	maxFetches = 64
+	// Timeout of a single fetch
+	fetchTimeout = 5 * time.Second
+)
+
+// DefaultParams subscribes to the hashes of pending transactions.
+var DefaultParams = []any{"newPendingTransactions"}
+
+// Mapping locates the transaction fields in the result of a subscription notification. Paths are keys
+// separated by dots, e.g. "transaction.hash". Empty paths default to the field names of an Ethereum
+// transaction object ("hash", "from", "to", "input"). If the result is a string, it's the transaction hash.
+type Mapping struct {
+	Hash  string
+	From  string
+	To    string
+	Input string
+}
+
+type Config struct {
+	// Name of the source in logs and stats
+	Name string
+	// Websocket endpoint
+	Endpoint string
+	// Headers sent with the websocket handshake, e.g. for authentication
+	Headers map[string]string
+	// Subscription method and params, e.g. "eth_subscribe" and ["alchemy_pendingTransactions", {"hashesOnly": true}]
+	Method string
+	Params []any
+	// Where to find the transaction fields in the notifications
+	Mapping Mapping
+	// JSON-RPC endpoint used to fetch the transaction details if only the hash is pushed. Defaults to Endpoint.
+	FetchEndpoint string
+}
+
+type Source struct {
+	sources.HealthTracker
+
+	config Config
+	dialer *websocket.Dialer
+	// Client for fetching transaction details, opened on connect
+	client *rpc.Client
+	// Limits the number of concurrent fetches
+	fetches chan struct{}
+
+	done chan struct{}
+}
+
+func init() {
+	sources.Register("jsonrpc", func(config sources.Config) (sources.Source, error) {
+		if config.Endpoint() == "" {
+			return nil, fmt.Errorf("jsonrpc: endpoint is required")
+		}
+
+		c := Config{Name: config.Name, Endpoint: config.Endpoint()}
+		var mapping map[string]string
+		for key, dst := range map[string]any{
+			"method":         &c.Method,
+			"params":         &c.Params,
+			"headers":        &c.Headers,
+			"mapping":        &mapping,
+			"fetch-endpoint": &c.FetchEndpoint,
+		} {
+			if err := config.Option(key, dst); err != nil {
+				return nil, err
+			}
+		}
+
+		for field, path := range mapping {
+			switch field {
+			case "hash":
+				c.Mapping.Hash = path
+			case "from":
+				c.Mapping.From = path
+			case "to":
+				c.Mapping.To = path
+			case "input":
+				c.Mapping.Input = path
+			default:
+				return nil, fmt.Errorf("jsonrpc: invalid mapping field: %s", field)
+			}
+		}
+
+		return NewSource(c), nil
+	})
+}
+
+type notification struct {
+	Params struct {
+		Result json.RawMessage
+	}
+}
+
+type response struct {
+	ID     *int
+	Result json.RawMessage
+	Error  *struct {
+		Code    int
+		Message string
+	}
+}
+
+// A transaction as returned by eth_getTransactionByHash
+type rpcTransaction struct {
+	From  string
+	To    string
+	Input hexutil.Bytes
+}
+
+// A pending transaction that was pushed by the provider
+type pending struct {
+	hash  common.Hash
+	from  string
+	to    string
+	input string
+	// Whether the notification had the transaction details, or only the hash
+	complete bool
+}
+
+func NewSource(config Config) *Source {
+	if config.Name == "" {
+		config.Name = DefaultName
+	}
+
+	if config.Method == "" {
+		config.Method = DefaultMethod
+	}
+
+	if config.Params == nil {
+		config.Params = DefaultParams
+	}
+
+	if config.FetchEndpoint == "" {
+		config.FetchEndpoint = config.Endpoint
+	}
+
+	return &Source{
+		config:  config,
+		dialer:  websocket.DefaultDialer,
+		fetches: make(chan struct{}, maxFetches),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *Source) Name() string {
+	return s.config.Name
+}
+
+func (s *Source) Capabilities() []sources.Capability {
+	return []sources.Capability{sources.Transactions}
+}
+
+// Connect opens the client that fetches transaction details. The subscription opens its own connection.
+func (s *Source) Connect(ctx context.Context) error {
+	client, err := rpc.DialContext(ctx, s.config.FetchEndpoint)
+	if err != nil {
+		s.Failed(err)
+		return err
+	}
+
+	s.client = client
+	s.SetConnected(true)
+	return nil
+}
+
+// readMessage reads the next message from the websocket connection. The returned timestamp (in microseconds)
+// is taken as soon as the first frame of the message is read, before the rest of the message is read or decoded.
+func readMessage(conn *websocket.Conn) ([]byte, int64, error) {
+	_, r, err := conn.NextReader()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	receivedAt := time.Now().UnixMicro()
+
+	msg, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return msg, receivedAt, nil
+}
+
+// subscribe opens the websocket connection and sends the subscription request. It returns once the
+// subscription is confirmed.
+func (s *Source) subscribe(ctx context.Context) (*websocket.Conn, error) {
+	header := make(http.Header)
+	for key, value := range s.config.Headers {
+		header.Set(key, value)
+	}
+
+	conn, _, err := s.dialer.DialContext(ctx, s.config.Endpoint, header)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  s.config.Method,
+		"params":  s.config.Params,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Skip anything that isn't the response to the subscription request
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		var resp response
+		if err := json.Unmarshal(msg, &resp); err != nil || resp.ID == nil || *resp.ID != 1 {
+			continue
+		}
+
+		if resp.Error != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: subscription failed: %s (%d)", s.config.Method, resp.Error.Message, resp.Error.Code)
+		}
+
+		return conn, nil
+	}
+}
+
+// Subscribe to new transaction hashes. Transactions that were pushed without their details are fetched
+// with eth_getTransactionByHash. The timestamps are taken before fetching.
+func (s *Source) SubscribeTransactionObservations(ctx context.Context) (chan types.Observation, error) {
+	hashCh := make(chan types.Observation, types.OBSERVATION_BUFFER_SIZE)
+
+	if s.client == nil {
+		if err := s.Connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := s.subscribe(ctx)
+	if err != nil {
+		s.Failed(err)
+		s.SetConnected(false)
+		return nil, err
+	}
+
+	// Also marks the source as connected again if it's resubscribed after an error
+	s.SetConnected(true)
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+		}
+		close(stopped)
+		conn.Close()
+	}()
+
+	// Fetches that are in flight when the subscription stops still send on the channel
+	var fetches sync.WaitGroup
+
+	go func() {
+		defer func() {
+			fetches.Wait()
+			close(hashCh)
+		}()
+
+		for {
+			msg, receivedAt, err := readMessage(conn)
+			select {
+			case <-stopped:
+				// We're done, the connection is closed
+				return
+			default:
+			}
+
+			if err != nil {
+				// The connection can't be read from after an error
+				log.Println(err)
+				s.Failed(err)
+				s.SetConnected(false)
+				return
+			}
+
+			var decoded notification
+			if err := json.Unmarshal(msg, &decoded); err != nil {
+				log.Println(err)
+				continue
+			}
+
+			tx, err := s.config.Mapping.parse(decoded.Params.Result)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+
+			observation := types.Observation{
+				Hash:          tx.hash,
+				WireTimestamp: receivedAt,
+				Timestamp:     time.Now().UnixMicro(),
+				CallDataSize:  int64(len(common.FromHex(tx.input))),
+				From:          tx.from,
+				To:            tx.to,
+			}
+
+			s.Observed()
+
+			if tx.complete {
+				hashCh <- observation
+				continue
+			}
+
+			// The fetch limit is waited for in the goroutine, so that the read loop never blocks and the
+			// timestamps of later messages aren't delayed
+			fetches.Add(1)
+			go func() {
+				defer fetches.Done()
+
+				s.fetches <- struct{}{}
+				s.fetch(ctx, &observation)
+				<-s.fetches
+
+				hashCh <- observation
+			}()
+		}
+	}()
+
+	return hashCh, nil
+}
+
+// fetch fills in the details of the observed transaction. If the transaction can't be fetched, the
+// observation is left without details.
+func (s *Source) fetch(ctx context.Context, observation *types.Observation) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	var tx *rpcTransaction
+	if err := s.client.CallContext(ctx, &tx, "eth_getTransactionByHash", observation.Hash); err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Unknown to the node, e.g. because it was already dropped
+	if tx == nil {
+		return
+	}
+
+	observation.From = tx.From
+	observation.To = tx.To
+	observation.CallDataSize = int64(len(tx.Input))
+}
+
+// Closes all open subscriptions
+func (s *Source) Close() error {
+	s.SetConnected(false)
+	close(s.done)
+	if s.client != nil {
+		s.client.Close()
+	}
+
+	return nil
+}
+
+// parse extracts the transaction from the result of a notification.
+func (m Mapping) parse(result json.RawMessage) (*pending, error) {
+	var hash string
+	if err := json.Unmarshal(result, &hash); err == nil {
+		return &pending{hash: common.HexToHash(hash)}, nil
+	}
+
+	var object map[string]any
+	if err := json.Unmarshal(result, &object); err != nil {
+		return nil, fmt.Errorf("unexpected notification result: %s", result)
+	}
+
+	hash, ok := lookup(object, m.Hash, "hash")
+	if !ok {
+		return nil, fmt.Errorf("notification result without hash: %s", result)
+	}
+
+	tx := &pending{hash: common.HexToHash(hash)}
+	tx.from, _ = lookup(object, m.From, "from")
+	tx.to, _ = lookup(object, m.To, "to")
+	tx.input, tx.complete = lookup(object, m.Input, "input")
+
+	return tx, nil
+}
+
+// lookup returns the string at the path in the object, or at the fallback path if the path is empty.
+func lookup(object map[string]any, path, fallback string) (string, bool) {
+	if path == "" {
+		path = fallback
+	}
+
+	var value any = object
+	for _, key := range strings.Split(path, ".") {
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+
+		if value, ok = fields[key]; !ok {
+			return "", false
+		}
+	}
+
+	s, ok := value.(string)
+	return s, ok
+}
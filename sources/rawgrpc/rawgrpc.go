@@ -0,0 +1,68 @@
+// Package rawgrpc reads gRPC streams as raw bytes, so that sources can take the receive timestamp of a message
+// before decoding it.
+package rawgrpc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Codec passes messages through as bytes. Messages have to be of type *[]byte.
+type Codec struct{}
+
+func (Codec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+
+	return *b, nil
+}
+
+func (Codec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (Codec) Name() string {
+	return "proto"
+}
+
+// DecodeFields calls fn with every field of a protobuf message. Length-delimited values are passed
+// without their length prefix, other values are skipped.
+func DecodeFields(msg []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			msg = msg[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
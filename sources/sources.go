@@ -0,0 +1,198 @@
+// Package sources defines the interface of data sources and a registry, so that every source can be
+// instantiated by its type from config.
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chainbound/fiber-benchmarks/types"
+)
+
+// Capability is a kind of data that a source can stream.
+type Capability string
+
+const (
+	Transactions Capability = "transactions"
+	Blocks       Capability = "blocks"
+	Beacon       Capability = "beacon"
+	Blobs        Capability = "blobs"
+)
+
+// Source is the lifecycle of a data source. Sources stream data through the subscription interfaces of
+// their capabilities, e.g. TransactionSource.
+type Source interface {
+	// Name of the source in logs and stats
+	Name() string
+	Connect(ctx context.Context) error
+	Close() error
+	Capabilities() []Capability
+	Health() Health
+}
+
+type TransactionSource interface {
+	Source
+	// Subscribe to new transactions. The channel is closed once the context is canceled or the source is closed.
+	SubscribeTransactionObservations(ctx context.Context) (chan types.Observation, error)
+}
+
+type BlockSource interface {
+	Source
+	// Subscribe to new blocks. The channel is closed once the context is canceled or the source is closed.
+	SubscribeBlockObservations(ctx context.Context) (chan types.BlockObservation, error)
+}
+
+// Has returns true if the source has the capability.
+func Has(source Source, capability Capability) bool {
+	for _, c := range source.Capabilities() {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Config of a single source.
+type Config struct {
+	// Type of the source, which its factory is registered with
+	Type string
+	// Name in logs and stats. Defaults to the type.
+	Name      string
+	Endpoints []string
+	Key       string
+	// Options that are specific to the type
+	Options map[string]any
+}
+
+// Endpoint returns the first endpoint, or an empty string if there is none.
+func (c Config) Endpoint() string {
+	if len(c.Endpoints) == 0 {
+		return ""
+	}
+
+	return c.Endpoints[0]
+}
+
+// Option decodes the option into dst, which is left untouched if the option isn't set.
+func (c Config) Option(key string, dst any) error {
+	value, ok := c.Options[key]
+	if !ok {
+		return nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("option %s: %w", key, err)
+	}
+
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("option %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Factory returns a new, unconnected source for the config.
+type Factory func(config Config) (Source, error)
+
+var (
+	factories   = make(map[string]Factory)
+	factoryLock sync.RWMutex
+)
+
+// Register makes a source type available by name. It's meant to be called from init functions and
+// panics if the type is registered twice.
+func Register(typ string, factory Factory) {
+	factoryLock.Lock()
+	defer factoryLock.Unlock()
+
+	if _, ok := factories[typ]; ok {
+		panic("sources: type registered twice: " + typ)
+	}
+
+	factories[typ] = factory
+}
+
+// Types returns the registered source types in order.
+func Types() []string {
+	factoryLock.RLock()
+	defer factoryLock.RUnlock()
+
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// New instantiates a source of the configured type.
+func New(config Config) (Source, error) {
+	factoryLock.RLock()
+	factory, ok := factories[config.Type]
+	factoryLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown source type: %s", config.Type)
+	}
+
+	if config.Name == "" {
+		config.Name = config.Type
+	}
+
+	return factory(config)
+}
+
+// Health of a source.
+type Health struct {
+	Connected bool
+	// Number of observations since the source was connected
+	Observations uint64
+	// Time of the last observation, zero if there was none
+	LastObservation time.Time
+	// Last error that the source ran into, if any
+	Err error
+}
+
+// HealthTracker implements Health for sources that embed it.
+type HealthTracker struct {
+	health Health
+	lock   sync.Mutex
+}
+
+func (t *HealthTracker) Health() Health {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.health
+}
+
+func (t *HealthTracker) SetConnected(connected bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.health.Connected = connected
+}
+
+// Observed records an observation.
+func (t *HealthTracker) Observed() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.health.Observations++
+	t.health.LastObservation = time.Now()
+}
+
+// Failed records an error.
+func (t *HealthTracker) Failed(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.health.Err = err
+}
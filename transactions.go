@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
+	"github.com/chainbound/fiber-benchmarks/health"
 	"github.com/chainbound/fiber-benchmarks/log"
 	"github.com/chainbound/fiber-benchmarks/sinks"
-	"github.com/chainbound/fiber-benchmarks/sources/bloxroute"
+	"github.com/chainbound/fiber-benchmarks/sources"
 	"github.com/chainbound/fiber-benchmarks/sources/fiber"
 	"github.com/chainbound/fiber-benchmarks/types"
 	f "github.com/chainbound/fiber-go"
@@ -20,36 +24,69 @@ type TransactionBenchmarker struct {
 	logger zerolog.Logger
 
 	fiberSource     *fiber.FiberSource
-	otherSource     TransactionSource
+	other           *otherStream[types.Observation]
 	otherSourceName string
 
-	sink Sink
+	// Separate sources for every Fiber endpoint, and the ones whose stream ended. Only set in per-endpoint mode.
+	endpointSources []*fiber.FiberSource
+	endpointClosed  chan *fiber.FiberSource
+
+	sink sinks.Sink
 }
 
-func runTransactionBenchmark(config *config) error {
+func runTransactionBenchmark(ctx context.Context, config *config) error {
 	// - For each interval, we collect all data from both streams
 	// - At the end of the interval, we print the stats and save the result
 	// - At the end of the benchmark, we print the overall stats
 	logger := log.NewLogger("benchmark")
 
 	if err := config.validate(); err != nil {
-		logger.Fatal().Err(err).Msg("Invalid config")
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	fiberSource, err := newFiberSource(config)
+	if err != nil {
+		return err
+	}
+
+	if err := fiberSource.Connect(ctx); err != nil {
+		return err
+	}
+
+	var endpointSources []*fiber.FiberSource
+	if config.perEndpoint {
+		endpointSources = fiber.NewEndpointSources(config.fiberConfig().Endpoints, config.fiberConfig().Key)
+		for _, source := range endpointSources {
+			if err := source.Connect(ctx); err != nil {
+				return fmt.Errorf("connecting to %s: %w", source.Endpoint(), err)
+			}
+		}
 	}
 
-	fiberSource := fiber.NewFiberSource(config.fiberEndpoints, config.fiberKey)
-	if err := fiberSource.Connect(); err != nil {
+	source, err := newOtherSource(config)
+	if err != nil {
 		return err
 	}
 
-	var otherSource TransactionSource
-	var otherSourceName string
+	other := &otherStream[types.Observation]{logger: logger}
+	if source == nil {
+		logger.Warn().Msg("No source to compare against, running in Fiber-only mode")
+	} else {
+		otherSource, ok := source.(sources.TransactionSource)
+		if !ok || !sources.Has(source, sources.Transactions) {
+			return fmt.Errorf("the %s source doesn't support transactions", source.Name())
+		}
+
+		// The source is subscribed to again before every interval, so it's fine if it can't be reached yet
+		if err := otherSource.Connect(ctx); err != nil {
+			logger.Warn().Err(err).Str("source", otherSource.Name()).Msg("Failed to connect")
+		}
 
-	if config.blxrEndpoint != "" && config.blxrKey != "" {
-		otherSource = bloxroute.NewBloxrouteSource(config.blxrEndpoint, config.blxrKey)
-		otherSourceName = "bloxroute"
+		other.source = otherSource
+		other.subscribe = otherSource.SubscribeTransactionObservations
 	}
 
-	sink, err := setupSink(config, sinks.Transactions)
+	sink, err := setupSink(ctx, config, sinks.Transactions)
 	if err != nil {
 		return err
 	}
@@ -58,29 +95,85 @@ func runTransactionBenchmark(config *config) error {
 		config:          config,
 		logger:          logger,
 		fiberSource:     fiberSource,
-		otherSource:     otherSource,
-		otherSourceName: otherSourceName,
+		other:           other,
+		otherSourceName: other.name(),
+		endpointSources: endpointSources,
 		sink:            sink,
 	}
 
-	benchmarker.Run()
-
-	return nil
+	return benchmarker.Run(ctx)
 }
 
-func (b *TransactionBenchmarker) Run() {
-	var (
-		fiberStream   = b.fiberSource.SubscribeTransactionObservations()
-		otherStream   = b.otherSource.SubscribeTransactionObservations()
-		payloadStream = b.fiberSource.SubscribeExecutionPayloads()
-	)
-
+// Run runs the benchmark until all intervals are done, a stream is closed or the context is canceled. On an
+// interrupt, the current interval is discarded and the sinks are still flushed. The run metadata is recorded
+// when the benchmark starts and when it's done.
+func (b *TransactionBenchmarker) Run(ctx context.Context) (err error) {
+	defer b.sink.Close()
 	defer b.fiberSource.Close()
+	defer b.other.close()
+	for _, source := range b.endpointSources {
+		defer source.Close()
+	}
+
+	// Sinks are flushed with the parent context, which isn't canceled by the interrupt
+	sinkCtx := ctx
+	ctx, stop := interruptible(ctx)
+	defer stop()
+
+	metadata := newRunMetadata(b.config, sinks.Transactions, b.other.source)
+	recordRunMetadata(sinkCtx, b.logger, b.sink, metadata)
+	defer func() {
+		finishRunMetadata(metadata, ctx.Err() != nil, err)
+		recordRunMetadata(sinkCtx, b.logger, b.sink, metadata)
+	}()
+
+	b.other.resubscribe(ctx)
+
+	payloadStream := b.fiberSource.SubscribeExecutionPayloads()
+
+	var fiberStream chan types.Observation
+	if len(b.endpointSources) > 0 {
+		fiberStream, b.endpointClosed, err = mergeObservations(ctx, b.endpointSources)
+	} else {
+		fiberStream, err = b.fiberSource.SubscribeTransactionObservations(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("subscribing to fiber: %w", err)
+	}
+
+	if b.config.warmup > 0 {
+		b.logger.Info().Str("duration", b.config.warmup.String()).Msg("Warming up")
+		w := newWarmUp(ctx, b.config.warmup)
+		discard(w, "fiber", fiberStream)
+		discard(w, b.otherSourceName, b.other.ch)
+		discard(w, "payloads", payloadStream)
+		for name, n := range w.wait() {
+			b.logger.Info().Str("stream", name).Int("discarded", n).Msg("Warm-up complete")
+		}
+	}
+
+	monitor := health.NewMonitor(b.config.healthSampleInterval, b.config.healthThresholds)
+	health.Watch(monitor, "fiber", fiberStream)
+	health.Watch(monitor, b.otherSourceName, b.other.ch)
+	monitor.Start()
+	defer monitor.Stop()
+
 	for i := 0; i < b.config.intervalCount; i++ {
+		if b.other.resubscribe(ctx) {
+			health.Watch(monitor, b.otherSourceName, b.other.ch)
+		}
+
 		start := time.Now()
 		b.logger.Info().Int("interval", i+1).Msg("Running benchmark interval")
-		fmt.Println()
-		stats, err := b.runInterval(fiberStream, otherStream, payloadStream)
+		fmt.Fprintln(log.Console)
+		stats, err := b.runInterval(ctx, fiberStream, payloadStream)
+		if ctx.Err() != nil {
+			b.logger.Warn().Int("interval", i+1).Msg("Benchmark interrupted, discarding the current interval")
+			return nil
+		}
+		if errors.Is(err, errStreamClosed) {
+			return err
+		}
 		if err != nil {
 			b.logger.Error().Err(err).Msg("Failed to run interval")
 		}
@@ -88,69 +181,150 @@ func (b *TransactionBenchmarker) Run() {
 		stats.StartTime = start
 		stats.EndTime = end
 		stats.BenchmarkID = b.config.benchmarkID
+		applyHealth(b.logger, &stats, monitor.Collect())
+		b.printSourceHealth()
 		b.sink.RecordStats(&stats)
-		if err := b.sink.Flush(); err != nil {
+		metadata.Intervals++
+		if stats.Tainted {
+			metadata.TaintedIntervals++
+		}
+		if err := b.sink.Flush(sinkCtx); err != nil {
 			b.logger.Error().Err(err).Msg("Failed to flush sink")
 		}
 	}
 
 	b.logger.Info().Msg("Benchmark complete")
+	return nil
 }
 
-// Runs the interval
-func (b *TransactionBenchmarker) runInterval(fiberStream chan types.Observation, otherStream chan types.Observation, payloadStream chan *f.Block) (types.ObservationStatsRow, error) {
+func (b *TransactionBenchmarker) printSourceHealth() {
+	if b.other.source == nil {
+		printSourceHealth(b.logger, b.fiberSource)
+		return
+	}
+
+	printSourceHealth(b.logger, b.fiberSource, b.other.source)
+}
+
+// Runs the interval. The other source only counts as live if its stream was open for the whole interval.
+func (b *TransactionBenchmarker) runInterval(ctx context.Context, fiberStream chan types.Observation, payloadStream chan *f.Block) (types.ObservationStatsRow, error) {
 	// Setup
 	var (
 		fiberMap = make(map[common.Hash]types.Observation)
 		otherMap = make(map[common.Hash]types.Observation)
-		truthMap = make(map[common.Hash]struct{})
+		truthMap = make(map[common.Hash]types.Inclusion)
+
+		fiberDups = newDuplicates()
+		otherDups = newDuplicates()
+
+		// Observations and duplicates per Fiber endpoint. Only used in per-endpoint mode.
+		endpointMaps map[string]map[common.Hash]types.Observation
+		endpointDups map[string]*duplicates
 	)
 
+	if len(b.endpointSources) > 0 {
+		endpointMaps = make(map[string]map[common.Hash]types.Observation, len(b.endpointSources))
+		endpointDups = make(map[string]*duplicates, len(b.endpointSources))
+		for _, source := range b.endpointSources {
+			endpointMaps[source.Endpoint()] = make(map[common.Hash]types.Observation)
+			endpointDups[source.Endpoint()] = newDuplicates()
+		}
+	}
+
 	// Initialize interval timer
 	timer := time.NewTimer(b.config.interval)
 	end := time.Now().Add(b.config.interval)
 
-	b.logger.Info().Int("fiber", len(fiberStream)).Int("other", len(otherStream)).Msg("Buffered observations")
+	b.logger.Info().Int("fiber", len(fiberStream)).Int("other", len(b.other.ch)).Msg("Buffered observations")
+
+	otherLive := b.other.live()
 
 loop:
 	for {
 		select {
 		case <-timer.C:
 			break loop
-		case fiberObs := <-fiberStream:
-			// If we're not in the tail window, continue as usual
-			if _, ok := fiberMap[fiberObs.Hash]; !ok {
+		case <-ctx.Done():
+			return types.ObservationStatsRow{}, ctx.Err()
+		case fiberObs, ok := <-fiberStream:
+			if !ok {
+				return types.ObservationStatsRow{}, streamClosed(b.fiberSource)
+			}
+
+			if endpointMaps != nil {
+				b.recordEndpointObservation(fiberObs, fiberMap, endpointMaps, endpointDups)
+				continue
+			}
+
+			// Only the first observation is kept, repeats are counted
+			if !fiberDups.observe(fiberObs.Hash, fiberObs.WireTimestamp) {
 				fiberMap[fiberObs.Hash] = fiberObs
-			} else {
-				b.logger.Warn().Str("hash", fiberObs.Hash.Hex()).Str("source", "fiber").Msg("Duplicate hash during interval")
 			}
-		case otherObs := <-otherStream:
-			if _, ok := otherMap[otherObs.Hash]; !ok {
+		case source := <-b.endpointClosed:
+			// Like the multiplexed stream, the benchmark stops once the stream of any endpoint ends
+			return types.ObservationStatsRow{}, streamClosed(source)
+		case otherObs, ok := <-b.other.ch:
+			if !ok {
+				b.other.closed()
+				otherLive = false
+				continue
+			}
+
+			if !otherDups.observe(otherObs.Hash, otherObs.WireTimestamp) {
 				otherMap[otherObs.Hash] = otherObs
-			} else {
-				b.logger.Warn().Str("hash", otherObs.Hash.Hex()).Str("source", b.otherSourceName).Msg("Duplicate hash during interval")
 			}
-		case payload := <-payloadStream:
+		case payload, ok := <-payloadStream:
+			if !ok {
+				return types.ObservationStatsRow{}, streamClosed(b.fiberSource)
+			}
+
 			if b.config.crossCheck {
-				for _, tx := range payload.Transactions {
-					truthMap[tx.Hash()] = struct{}{}
+				payloadTs := time.Now().UnixMicro()
+				for i, tx := range payload.Transactions {
+					truthMap[tx.Hash()] = types.Inclusion{
+						BlockNumber:      payload.Header.Number.Uint64(),
+						TxIndex:          i,
+						SlotTimestamp:    int64(payload.Header.Time) * 1_000_000,
+						PayloadTimestamp: payloadTs,
+					}
 				}
-				if b.config.sink != "clickhouse" {
-					fmt.Printf("\033[1A\033[K")
+				if !b.config.hasSink("clickhouse") {
+					fmt.Fprint(log.Console, "\033[1A\033[K")
 					b.logger.Info().Int("block_number", int(payload.Header.Number.Int64())).Int("amount_confirmed", len(truthMap)).Str("remaining", time.Until(end).String()).Msg("Recorded execution payload transactions")
 				}
 			}
 		}
 	}
 
-	return b.processIntervalResults(fiberMap, otherMap, truthMap)
+	if endpointMaps != nil {
+		// Partial observations of the other source would skew the comparison
+		endpointOtherMap := otherMap
+		if !otherLive {
+			endpointOtherMap = nil
+		}
+
+		b.processEndpointResults(endpointMaps, endpointOtherMap, truthMap)
+
+		dups := make([]*duplicates, 0, len(endpointDups))
+		for _, endpoint := range b.config.fiberConfig().Endpoints {
+			endpointDups[endpoint].print(b.logger, endpoint)
+			dups = append(dups, endpointDups[endpoint])
+		}
+
+		fiberDups = mergeDuplicates(dups)
+	}
+
+	return b.processIntervalResults(fiberMap, otherMap, truthMap, fiberDups, otherDups, otherLive)
 }
 
-func (b *TransactionBenchmarker) processIntervalResults(fiberMap, otherMap map[common.Hash]types.Observation, truthMap map[common.Hash]struct{}) (types.ObservationStatsRow, error) {
+func (b *TransactionBenchmarker) processIntervalResults(fiberMap, otherMap map[common.Hash]types.Observation, truthMap map[common.Hash]types.Inclusion, fiberDups, otherDups *duplicates, otherLive bool) (types.ObservationStatsRow, error) {
 	diffMap := make(map[common.Hash]float64, len(truthMap))
 	differences := make([]float64, 0, len(truthMap))
+	fiberLeads := new(leadTimes)
+	otherLeads := new(leadTimes)
+	outliers := 0
 
-	for hash := range truthMap {
+	for hash, inclusion := range truthMap {
 		var (
 			fiberSaw = false
 			otherSaw = false
@@ -168,6 +342,22 @@ func (b *TransactionBenchmarker) processIntervalResults(fiberMap, otherMap map[c
 
 		fiberTs := fiberObs.Timestamp
 		otherTs := otherObs.Timestamp
+		fiberWireTs := fiberObs.WireTimestamp
+		otherWireTs := otherObs.WireTimestamp
+
+		if fiberSaw && otherSaw && b.config.isOutlier(otherTs-fiberTs) {
+			b.logger.Debug().Str("hash", hash.Hex()).Int64("diff", otherTs-fiberTs).Msg("Discarding outlier")
+			outliers++
+			continue
+		}
+
+		if fiberSaw {
+			fiberLeads.add(fiberTs, inclusion)
+		}
+
+		if otherSaw {
+			otherLeads.add(otherTs, inclusion)
+		}
 
 		switch {
 		case fiberSaw && otherSaw:
@@ -179,32 +369,57 @@ func (b *TransactionBenchmarker) processIntervalResults(fiberMap, otherMap map[c
 
 			if b.sink != nil {
 				b.sink.RecordObservationRow(&types.ConfirmedObservationRow{
-					TxHash:         hash.Hex(),
-					FiberTimestamp: fiberTs,
-					OtherTimestamp: otherTs,
-					Difference:     microDiff,
-					BenchmarkID:    b.config.benchmarkID,
-					From:           fiberObs.From,
-					To:             fiberObs.To,
-					CallDataSize:   fiberObs.CallDataSize,
+					TxHash:             hash.Hex(),
+					FiberTimestamp:     fiberTs,
+					OtherTimestamp:     otherTs,
+					FiberWireTimestamp: fiberWireTs,
+					OtherWireTimestamp: otherWireTs,
+					Difference:         microDiff,
+					BenchmarkID:        b.config.benchmarkID,
+					From:               fiberObs.From,
+					To:                 fiberObs.To,
+					CallDataSize:       fiberObs.CallDataSize,
+					FiberEndpoint:      fiberObs.Source,
+					BlockNumber:        inclusion.BlockNumber,
+					TxIndex:            int64(inclusion.TxIndex),
+					SlotTimestamp:      inclusion.SlotTimestamp,
+					PayloadTimestamp:   inclusion.PayloadTimestamp,
+
+					FiberDuplicates:        fiberDups.repeatsOf(hash),
+					OtherDuplicates:        otherDups.repeatsOf(hash),
+					FiberLastWireTimestamp: fiberDups.latestOf(hash),
+					OtherLastWireTimestamp: otherDups.latestOf(hash),
 				})
 			}
 		case fiberSaw && !otherSaw:
 			// Only Fiber saw the transaction
-			if b.config.logMissing {
+			if b.config.logMissing && otherLive {
 				b.logger.Warn().Str("hash", hash.Hex()).Msg(fmt.Sprintf("Fiber saw transaction but %s did not", b.otherSourceName))
 			}
 
 			if b.sink != nil {
 				b.sink.RecordObservationRow(&types.ConfirmedObservationRow{
-					TxHash:         hash.Hex(),
-					FiberTimestamp: fiberTs,
-					OtherTimestamp: 0,
-					Difference:     0,
-					BenchmarkID:    b.config.benchmarkID,
-					From:           fiberObs.From,
-					To:             fiberObs.To,
-					CallDataSize:   fiberObs.CallDataSize,
+					TxHash:             hash.Hex(),
+					FiberTimestamp:     fiberTs,
+					OtherTimestamp:     0,
+					FiberWireTimestamp: fiberWireTs,
+					OtherWireTimestamp: 0,
+					Difference:         0,
+					BenchmarkID:        b.config.benchmarkID,
+					From:               fiberObs.From,
+					To:                 fiberObs.To,
+					CallDataSize:       fiberObs.CallDataSize,
+					FiberEndpoint:      fiberObs.Source,
+					BlockNumber:        inclusion.BlockNumber,
+					TxIndex:            int64(inclusion.TxIndex),
+					SlotTimestamp:      inclusion.SlotTimestamp,
+					PayloadTimestamp:   inclusion.PayloadTimestamp,
+
+					FiberDuplicates:        fiberDups.repeatsOf(hash),
+					OtherDuplicates:        otherDups.repeatsOf(hash),
+					FiberLastWireTimestamp: fiberDups.latestOf(hash),
+					OtherLastWireTimestamp: otherDups.latestOf(hash),
+					OtherDown:              !otherLive,
 				})
 			}
 		case !fiberSaw && otherSaw:
@@ -215,40 +430,114 @@ func (b *TransactionBenchmarker) processIntervalResults(fiberMap, otherMap map[c
 
 			if b.sink != nil {
 				b.sink.RecordObservationRow(&types.ConfirmedObservationRow{
-					TxHash:         hash.Hex(),
-					FiberTimestamp: 0,
-					OtherTimestamp: otherTs,
-					Difference:     0,
-					BenchmarkID:    b.config.benchmarkID,
-					From:           otherObs.From,
-					To:             otherObs.To,
-					CallDataSize:   otherObs.CallDataSize,
+					TxHash:             hash.Hex(),
+					FiberTimestamp:     0,
+					OtherTimestamp:     otherTs,
+					FiberWireTimestamp: 0,
+					OtherWireTimestamp: otherWireTs,
+					Difference:         0,
+					BenchmarkID:        b.config.benchmarkID,
+					From:               otherObs.From,
+					To:                 otherObs.To,
+					CallDataSize:       otherObs.CallDataSize,
+					BlockNumber:        inclusion.BlockNumber,
+					TxIndex:            int64(inclusion.TxIndex),
+					SlotTimestamp:      inclusion.SlotTimestamp,
+					PayloadTimestamp:   inclusion.PayloadTimestamp,
+
+					FiberDuplicates:        fiberDups.repeatsOf(hash),
+					OtherDuplicates:        otherDups.repeatsOf(hash),
+					FiberLastWireTimestamp: fiberDups.latestOf(hash),
+					OtherLastWireTimestamp: otherDups.latestOf(hash),
 				})
 			}
 		}
 	}
 
-	if b.config.sink != "clickhouse" {
-		fmt.Println(types.MakeHistogram(differences))
+	fiberRate, fiberCoverage := rate(len(fiberMap), b.config.interval), coverage(fiberMap, truthMap)
+	printAbsoluteStats(b.logger, "fiber", fiberRate, fiberCoverage, len(truthMap))
+	fiberDups.print(b.logger, "fiber")
+	printDecodeOverhead(b.logger, "fiber", decodeOverheads(fiberMap))
+	fiberLeads.print(b.logger, "fiber")
+
+	if !otherLive {
+		b.logger.Warn().Msg(fmt.Sprintf("%s wasn't live for the whole interval, only reporting Fiber stats", b.otherSourceName))
+
+		stats := types.ObservationStatsRow{
+			FiberDuplicateRate: fiberDups.rate(),
+			FiberRate:          fiberRate,
+			FiberCoverage:      fiberCoverage,
+			LiveSources:        liveSources("fiber", b.otherSourceName, false),
+		}
+		stats.FiberPayloadLead, stats.FiberSlotLead = fiberLeads.medians()
+
+		return stats, nil
+	}
+
+	otherRate, otherCoverage := rate(len(otherMap), b.config.interval), coverage(otherMap, truthMap)
+
+	if !b.config.hasSink("clickhouse") {
+		fmt.Fprintln(log.Console, types.MakeHistogram(b.config.histogram, differences))
 		b.logger.Info().Msg(fmt.Sprintf("fiber total observations: %d", len(fiberMap)))
 		b.logger.Info().Msg(fmt.Sprintf("%s total observations: %d", b.otherSourceName, len(otherMap)))
 	}
 	b.printStats(differences)
+	printOutliers(b.logger, outliers)
+	printAbsoluteStats(b.logger, b.otherSourceName, otherRate, otherCoverage, len(truthMap))
+	otherDups.print(b.logger, b.otherSourceName)
+	printDecodeOverhead(b.logger, b.otherSourceName, decodeOverheads(otherMap))
+	otherLeads.print(b.logger, b.otherSourceName)
+	printFirstSeen(b.logger, b.otherSourceName, otherMap)
+
+	stats, err := buildObservationStats(differences, b.config.deadBand())
+	stats.FiberPayloadLead, stats.FiberSlotLead = fiberLeads.medians()
+	stats.OtherPayloadLead, stats.OtherSlotLead = otherLeads.medians()
+	stats.Outliers = int64(outliers)
+	stats.FiberDuplicateRate = fiberDups.rate()
+	stats.OtherDuplicateRate = otherDups.rate()
+	stats.FiberRate, stats.OtherRate = fiberRate, otherRate
+	stats.FiberCoverage, stats.OtherCoverage = fiberCoverage, otherCoverage
+	stats.LiveSources = liveSources("fiber", b.otherSourceName, true)
+
+	return stats, err
+}
 
-	return buildObservationStats(differences)
+// decodeOverheads returns the time between the wire and decoded timestamps of all observations in microseconds.
+func decodeOverheads(observations map[common.Hash]types.Observation) []float64 {
+	overheads := make([]float64, 0, len(observations))
+	for _, obs := range observations {
+		overheads = append(overheads, float64(obs.Timestamp-obs.WireTimestamp))
+	}
+
+	return overheads
 }
 
-func (b *TransactionBenchmarker) printStats(differences []float64) {
-	fiberWon := float64(0)
-	blxrWon := float64(0)
-
-	for _, diff := range differences {
-		if diff > 0 {
-			fiberWon++
-		} else {
-			blxrWon++
+// printFirstSeen prints how many observations were delivered first by each peer of a source that
+// reports them, like the devp2p source.
+func printFirstSeen(logger zerolog.Logger, name string, observations map[common.Hash]types.Observation) {
+	counts := make(map[string]int)
+	for _, obs := range observations {
+		if obs.Source != "" {
+			counts[obs.Source]++
 		}
 	}
+
+	if len(counts) == 0 {
+		return
+	}
+
+	peers := make([]string, 0, len(counts))
+	for peer := range counts {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return counts[peers[i]] > counts[peers[j]] })
+
+	for _, peer := range peers {
+		logger.Info().Str("peer", peer).Msg(fmt.Sprintf("%s first seen: %d (%.2f%%)", name, counts[peer], float64(counts[peer])/float64(len(observations))*100))
+	}
+}
+
+func (b *TransactionBenchmarker) printStats(differences []float64) {
 	mean, err := stats.Mean(differences)
 	if err != nil {
 		b.logger.Error().Err(err).Msg("Failed to calculate mean")
@@ -279,6 +568,6 @@ func (b *TransactionBenchmarker) printStats(differences []float64) {
 	b.logger.Info().Msg(fmt.Sprintf("Stdev: %.4fms", stdev))
 	b.logger.Info().Msg(fmt.Sprintf("Min: %.4fms | Max: %.4fms", min, max))
 
-	wonRatio := fiberWon / (fiberWon + blxrWon)
-	b.logger.Info().Msg(fmt.Sprintf("Fiber won: %.2f%%", wonRatio*100))
+	fiberWon, otherWon, tied := types.CountOutcomes(differences, b.config.deadBand()).Ratios()
+	b.logger.Info().Msg(fmt.Sprintf("Fiber won: %.2f%% | %s won: %.2f%% | Tied: %.2f%%", fiberWon*100, b.otherSourceName, otherWon*100, tied*100))
 }
@@ -0,0 +1,357 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Scale string
+
+const (
+	// Bins of equal width between min and max
+	LinearScale Scale = "linear"
+	// Bins of exponentially increasing width. If the range contains 0, bins are mirrored around it.
+	LogScale Scale = "log"
+	// Linear bins of a round width between the 1st and 99th percentile of the data
+	AutoScale Scale = "auto"
+)
+
+type HistogramView string
+
+const (
+	BarsView      HistogramView = "bars"
+	CDFView       HistogramView = "cdf"
+	SparklineView HistogramView = "sparkline"
+)
+
+func ParseScale(s string) (Scale, error) {
+	switch Scale(s) {
+	case LinearScale, LogScale, AutoScale:
+		return Scale(s), nil
+	default:
+		return "", fmt.Errorf("invalid histogram scale: %s", s)
+	}
+}
+
+func ParseHistogramView(s string) (HistogramView, error) {
+	switch HistogramView(s) {
+	case BarsView, CDFView, SparklineView:
+		return HistogramView(s), nil
+	default:
+		return "", fmt.Errorf("invalid histogram view: %s", s)
+	}
+}
+
+type HistogramConfig struct {
+	Scale Scale
+	View  HistogramView
+	// Number of bins between min and max. Values outside of the range are counted in 2 extra open-ended bins.
+	Bins int
+	// Range of the bins. Ignored by the auto scale.
+	Min float64
+	Max float64
+}
+
+// Validate checks if the histogram can be built with this config.
+func (c HistogramConfig) Validate() error {
+	if _, err := ParseScale(string(c.Scale)); err != nil {
+		return err
+	}
+
+	if _, err := ParseHistogramView(string(c.View)); err != nil {
+		return err
+	}
+
+	if c.Bins < 1 {
+		return fmt.Errorf("histogram needs at least 1 bin")
+	}
+
+	if c.Scale != AutoScale && c.Max <= c.Min {
+		return fmt.Errorf("histogram max must be larger than min")
+	}
+
+	if c.Scale == LogScale && c.Min < 0 && c.Max > 0 && c.Bins < 3 {
+		return fmt.Errorf("a logarithmic histogram around 0 needs at least 3 bins")
+	}
+
+	return nil
+}
+
+type Histogram struct {
+	// Edges of the bins, in ascending order. Bin i covers [Edges[i-1], Edges[i]), and the last bin includes
+	// its upper edge.
+	Edges []float64
+	// Counts[0] are values below the first edge, Counts[len(Edges)] values above the last edge.
+	Counts []int
+	Total  int
+}
+
+func NewHistogram(cfg HistogramConfig, data []float64) *Histogram {
+	var edges []float64
+
+	switch cfg.Scale {
+	case LogScale:
+		edges = logEdges(cfg.Min, cfg.Max, cfg.Bins)
+	case AutoScale:
+		edges = autoEdges(data, cfg.Bins)
+	default:
+		edges = linearEdges(cfg.Min, cfg.Max, cfg.Bins)
+	}
+
+	h := &Histogram{
+		Edges:  edges,
+		Counts: make([]int, len(edges)+1),
+		Total:  len(data),
+	}
+
+	for _, value := range data {
+		h.Counts[h.binIndex(value)]++
+	}
+
+	return h
+}
+
+func (h *Histogram) binIndex(value float64) int {
+	last := len(h.Edges) - 1
+
+	switch {
+	case value < h.Edges[0]:
+		return 0
+	case value > h.Edges[last]:
+		return last + 1
+	case value == h.Edges[last]:
+		return last
+	}
+
+	// Index of the first edge that is larger than the value, which is the bin the value falls in
+	return sort.Search(len(h.Edges), func(i int) bool { return h.Edges[i] > value })
+}
+
+func (h *Histogram) binStart(i int) string {
+	if i == 0 {
+		return "-∞"
+	}
+
+	return formatEdge(h.Edges[i-1])
+}
+
+func (h *Histogram) binEnd(i int) string {
+	if i == len(h.Edges) {
+		return "+∞"
+	}
+
+	return formatEdge(h.Edges[i])
+}
+
+// String returns one line per bin with the share of the values and a bar.
+func (h *Histogram) String() string {
+	result := ""
+	for i, count := range h.Counts {
+		percentage := h.percentage(count)
+		bar := getHistogramBar(int(percentage))
+
+		result += fmt.Sprintf("%6s <-> %6s  %6.2f%%  %4s %s\n", h.binStart(i), h.binEnd(i), percentage, strconv.Itoa(count), bar)
+	}
+
+	return result
+}
+
+// CDF returns one line per bin with the share of the values up to and including that bin.
+func (h *Histogram) CDF() string {
+	result := ""
+	cumulative := 0
+	for i, count := range h.Counts {
+		cumulative += count
+		percentage := h.percentage(cumulative)
+		bar := getHistogramBar(int(percentage))
+
+		result += fmt.Sprintf("<= %6s  %6.2f%%  %s\n", h.binEnd(i), percentage, bar)
+	}
+
+	return result
+}
+
+// Sparkline returns the histogram as a single line, with the range of the bins on both sides.
+func (h *Histogram) Sparkline() string {
+	levels := []rune("▁▂▃▄▅▆▇█")
+
+	max := 0
+	for _, count := range h.Counts {
+		if count > max {
+			max = count
+		}
+	}
+
+	var b strings.Builder
+	for _, count := range h.Counts {
+		if count == 0 || max == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+
+		b.WriteRune(levels[(count*(len(levels)-1)+max-1)/max])
+	}
+
+	return fmt.Sprintf("%s |%s| %s", formatEdge(h.Edges[0]), b.String(), formatEdge(h.Edges[len(h.Edges)-1]))
+}
+
+func (h *Histogram) percentage(count int) float64 {
+	if h.Total == 0 {
+		return 0
+	}
+
+	return float64(count) / float64(h.Total) * 100
+}
+
+// MakeHistogram renders the data in the configured view.
+func MakeHistogram(cfg HistogramConfig, data []float64) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	h := NewHistogram(cfg, data)
+
+	switch cfg.View {
+	case CDFView:
+		return h.CDF()
+	case SparklineView:
+		return h.Sparkline()
+	default:
+		return h.String()
+	}
+}
+
+func getHistogramBar(count int) string {
+	barLength := count / 2
+	bar := strings.Repeat("█", barLength)
+	remainder := count % 2
+	if remainder > 0 {
+		bar += "▏"
+	}
+	return bar
+}
+
+func linearEdges(min, max float64, bins int) []float64 {
+	edges := make([]float64, bins+1)
+	width := (max - min) / float64(bins)
+	for i := range edges {
+		edges[i] = min + float64(i)*width
+	}
+
+	// Avoid rounding errors on the last edge
+	edges[bins] = max
+	return edges
+}
+
+// logEdges returns exponentially spaced edges. If the range contains 0, it's split into a negative and
+// positive half that mirror each other, with a linear bin around 0 of 1% of the smallest half. If the range
+// ends at 0, the linear bin starts or ends at 0 and the other half gets all other bins.
+func logEdges(min, max float64, bins int) []float64 {
+	if min > 0 {
+		return geometricEdges(min, max, bins)
+	}
+
+	if max < 0 {
+		edges := geometricEdges(-max, -min, bins)
+		return mirror(edges)
+	}
+
+	threshold := math.Min(-min, max) / 100
+	if threshold == 0 {
+		threshold = math.Max(-min, max) / 100
+	}
+
+	if min == 0 {
+		return append([]float64{0}, geometricEdges(threshold, max, bins-1)...)
+	}
+
+	if max == 0 {
+		return append(mirror(geometricEdges(threshold, -min, bins-1)), 0)
+	}
+
+	half := (bins - 1) / 2
+	negative := mirror(geometricEdges(threshold, -min, half))
+	positive := geometricEdges(threshold, max, bins-1-half)
+
+	return append(negative, positive...)
+}
+
+func geometricEdges(min, max float64, bins int) []float64 {
+	edges := make([]float64, bins+1)
+	ratio := math.Pow(max/min, 1/float64(bins))
+	for i := range edges {
+		edges[i] = min * math.Pow(ratio, float64(i))
+	}
+
+	edges[bins] = max
+	return edges
+}
+
+// mirror returns the negated edges in ascending order.
+func mirror(edges []float64) []float64 {
+	mirrored := make([]float64, len(edges))
+	for i, edge := range edges {
+		mirrored[len(edges)-1-i] = -edge
+	}
+
+	return mirrored
+}
+
+// autoEdges returns linear edges with a round width (1, 2 or 5 times a power of 10) that cover the 1st
+// up to the 99th percentile of the data in at most the given number of bins. Round edges can't always fit
+// in a single bin (e.g. around 0), so a single bin covers exactly that range.
+func autoEdges(data []float64, bins int) []float64 {
+	sorted := make([]float64, len(data))
+	copy(sorted, data)
+	sort.Float64s(sorted)
+
+	if len(sorted) == 0 {
+		return linearEdges(-1, 1, bins)
+	}
+
+	lo := sorted[int(float64(len(sorted)-1)*0.01)]
+	hi := sorted[int(math.Ceil(float64(len(sorted)-1)*0.99))]
+
+	if bins == 1 {
+		return []float64{lo, hi}
+	}
+
+	// Flooring the start can push the end past the last bin, in which case the next round width is used
+	width := niceWidth((hi - lo) / float64(bins))
+	for {
+		start := math.Floor(lo/width) * width
+
+		n := int(math.Ceil((hi - start) / width))
+		if n < 1 {
+			n = 1
+		}
+		if n <= bins {
+			return linearEdges(start, start+float64(n)*width, n)
+		}
+
+		width = niceWidth(width * 1.5)
+	}
+}
+
+// niceWidth returns the smallest width of 1, 2 or 5 times a power of 10 that is at least raw.
+func niceWidth(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, step := range []float64{1, 2, 5, 10} {
+		if step*magnitude >= raw {
+			return step * magnitude
+		}
+	}
+
+	return 10 * magnitude
+}
+
+func formatEdge(edge float64) string {
+	return strconv.FormatFloat(edge, 'g', 4, 64)
+}
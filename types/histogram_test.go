@@ -0,0 +1,177 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+// checkEdges checks that there are the given number of bins, and that the edges are ascending.
+func checkEdges(t *testing.T, edges []float64, bins int) {
+	t.Helper()
+
+	if len(edges) != bins+1 {
+		t.Fatalf("expected %d bins, got %d: %v", bins, len(edges)-1, edges)
+	}
+
+	for i := 1; i < len(edges); i++ {
+		if edges[i] <= edges[i-1] {
+			t.Fatalf("edges aren't ascending: %v", edges)
+		}
+	}
+}
+
+func TestLinearEdges(t *testing.T) {
+	edges := linearEdges(-10, 10, 4)
+	checkEdges(t, edges, 4)
+
+	for i, want := range []float64{-10, -5, 0, 5, 10} {
+		if edges[i] != want {
+			t.Errorf("edge %d = %v, want %v", i, edges[i], want)
+		}
+	}
+}
+
+func TestLogEdges(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		min, max float64
+		bins     int
+	}{
+		{"positive", 1, 1000, 3},
+		{"negative", -1000, -1, 3},
+		{"around zero", -100, 100, 9},
+		{"around zero, even", -100, 1000, 10},
+		{"from zero", 0, 100, 10},
+		{"to zero", -100, 0, 10},
+		{"from zero, single bin", 0, 100, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			edges := logEdges(tc.min, tc.max, tc.bins)
+			checkEdges(t, edges, tc.bins)
+
+			if edges[0] != tc.min || edges[len(edges)-1] != tc.max {
+				t.Errorf("edges should span [%v, %v], got %v", tc.min, tc.max, edges)
+			}
+		})
+	}
+
+	// Bins grow exponentially
+	edges := logEdges(1, 1000, 3)
+	for i, want := range []float64{1, 10, 100, 1000} {
+		if math.Abs(edges[i]-want) > 1e-9 {
+			t.Errorf("edge %d = %v, want %v", i, edges[i], want)
+		}
+	}
+
+	// The halves around 0 mirror each other
+	edges = logEdges(-100, 100, 9)
+	for i := range edges {
+		if math.Abs(edges[i]+edges[len(edges)-1-i]) > 1e-9 {
+			t.Errorf("edges aren't mirrored around 0: %v", edges)
+			break
+		}
+	}
+}
+
+func TestAutoEdges(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []float64
+		bins int
+	}{
+		// Flooring the start to 0 needs 11 bins of width 1
+		{"floored start", []float64{0.5, 10.4}, 10},
+		{"around zero", []float64{-3.7, 12.2}, 5},
+		{"negative", []float64{-123, -7}, 8},
+		{"constant", []float64{4, 4, 4}, 10},
+		{"single bin around zero", []float64{-0.2, 0.3}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lo, hi := tc.data[0], tc.data[len(tc.data)-1]
+			edges := autoEdges(tc.data, tc.bins)
+
+			bins := len(edges) - 1
+			if bins < 1 || bins > tc.bins {
+				t.Fatalf("expected 1 to %d bins, got %d: %v", tc.bins, bins, edges)
+			}
+
+			if edges[0] > lo || edges[bins] < hi {
+				t.Errorf("edges %v don't cover [%v, %v]", edges, lo, hi)
+			}
+
+			if bins > 1 {
+				width := edges[1] - edges[0]
+				if nice := niceWidth(width * 0.999); math.Abs(nice-width) > 1e-9 {
+					t.Errorf("width %v isn't round", width)
+				}
+			}
+		})
+	}
+
+	edges := autoEdges([]float64{0.5, 10.4}, 10)
+	for i, want := range []float64{0, 2, 4, 6, 8, 10, 12} {
+		if math.Abs(edges[i]-want) > 1e-9 {
+			t.Errorf("edge %d = %v, want %v", i, edges[i], want)
+		}
+	}
+}
+
+func TestNiceWidth(t *testing.T) {
+	for _, tc := range []struct {
+		raw, want float64
+	}{
+		{0, 1},
+		{0.7, 1},
+		{1, 1},
+		{1.2, 2},
+		{3, 5},
+		{7, 10},
+		{0.013, 0.02},
+		{420, 500},
+	} {
+		if got := niceWidth(tc.raw); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("niceWidth(%v) = %v, want %v", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestHistogramCounts(t *testing.T) {
+	cfg := HistogramConfig{Scale: LinearScale, Bins: 4, Min: 0, Max: 4}
+	h := NewHistogram(cfg, []float64{-1, 0, 0.5, 1, 2.9, 3, 4, 5})
+
+	// Below, [0, 1), [1, 2), [2, 3), [3, 4] including the last edge, above
+	want := []int{1, 2, 1, 1, 2, 1}
+	for i := range want {
+		if h.Counts[i] != want[i] {
+			t.Fatalf("counts = %v, want %v", h.Counts, want)
+		}
+	}
+
+	if h.Total != 8 {
+		t.Errorf("total = %d, want 8", h.Total)
+	}
+}
+
+func TestHistogramConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cfg   HistogramConfig
+		valid bool
+	}{
+		{"linear", HistogramConfig{Scale: LinearScale, View: BarsView, Bins: 10, Min: -5, Max: 5}, true},
+		{"auto ignores range", HistogramConfig{Scale: AutoScale, View: CDFView, Bins: 10}, true},
+		{"log from zero", HistogramConfig{Scale: LogScale, View: SparklineView, Bins: 1, Min: 0, Max: 5}, true},
+		{"log around zero", HistogramConfig{Scale: LogScale, View: BarsView, Bins: 3, Min: -5, Max: 5}, true},
+		{"log around zero, too few bins", HistogramConfig{Scale: LogScale, View: BarsView, Bins: 2, Min: -5, Max: 5}, false},
+		{"no bins", HistogramConfig{Scale: LinearScale, View: BarsView, Bins: 0, Min: -5, Max: 5}, false},
+		{"empty range", HistogramConfig{Scale: LinearScale, View: BarsView, Bins: 10, Min: 5, Max: 5}, false},
+		{"invalid scale", HistogramConfig{Scale: "sqrt", View: BarsView, Bins: 10, Min: -5, Max: 5}, false},
+		{"invalid view", HistogramConfig{Scale: LinearScale, View: "pie", Bins: 10, Min: -5, Max: 5}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.cfg.Validate(); (err == nil) != tc.valid {
+				t.Errorf("valid = %v, got error %v", tc.valid, err)
+			}
+		})
+	}
+}
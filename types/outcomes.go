@@ -0,0 +1,44 @@
+package types
+
+import "math"
+
+// Outcomes counts which source of a pair saw each transaction or block first.
+type Outcomes struct {
+	FiberWon int
+	OtherWon int
+	// Differences within the dead-band
+	Tied int
+}
+
+// CountOutcomes counts the outcomes of the differences (other - Fiber). Differences of at most deadBand
+// in either direction are ties, so timestamp noise isn't counted as a win for either source. Both are in
+// the same unit.
+func CountOutcomes(differences []float64, deadBand float64) Outcomes {
+	var o Outcomes
+	for _, diff := range differences {
+		switch {
+		case math.Abs(diff) <= deadBand:
+			o.Tied++
+		case diff > 0:
+			o.FiberWon++
+		default:
+			o.OtherWon++
+		}
+	}
+
+	return o
+}
+
+func (o Outcomes) Total() int {
+	return o.FiberWon + o.OtherWon + o.Tied
+}
+
+// Ratios returns the share of Fiber wins, other wins and ties. All are 0 if there are no outcomes.
+func (o Outcomes) Ratios() (fiberWon, otherWon, tied float64) {
+	total := float64(o.Total())
+	if total == 0 {
+		return 0, 0, 0
+	}
+
+	return float64(o.FiberWon) / total, float64(o.OtherWon) / total, float64(o.Tied) / total
+}
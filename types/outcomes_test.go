@@ -0,0 +1,35 @@
+package types
+
+import "testing"
+
+func TestCountOutcomes(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		differences []float64
+		deadBand    float64
+		want        Outcomes
+	}{
+		{"no dead-band", []float64{-2, -0.1, 0, 0.1, 2}, 0, Outcomes{FiberWon: 2, OtherWon: 2, Tied: 1}},
+		{"inside", []float64{-0.4, 0, 0.4}, 0.5, Outcomes{Tied: 3}},
+		{"on the boundary", []float64{-0.5, 0.5}, 0.5, Outcomes{Tied: 2}},
+		{"just outside", []float64{-0.5001, 0.5001}, 0.5, Outcomes{FiberWon: 1, OtherWon: 1}},
+		{"empty", nil, 0.5, Outcomes{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CountOutcomes(tc.differences, tc.deadBand); got != tc.want {
+				t.Errorf("CountOutcomes(%v, %v) = %+v, want %+v", tc.differences, tc.deadBand, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOutcomesRatios(t *testing.T) {
+	fiberWon, otherWon, tied := Outcomes{FiberWon: 2, OtherWon: 1, Tied: 1}.Ratios()
+	if fiberWon != 0.5 || otherWon != 0.25 || tied != 0.25 {
+		t.Errorf("ratios = %v, %v, %v, want 0.5, 0.25, 0.25", fiberWon, otherWon, tied)
+	}
+
+	if fiberWon, otherWon, tied := (Outcomes{}).Ratios(); fiberWon != 0 || otherWon != 0 || tied != 0 {
+		t.Errorf("ratios without outcomes = %v, %v, %v, want 0", fiberWon, otherWon, tied)
+	}
+}
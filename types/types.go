@@ -1,39 +1,66 @@
 package types
 
 import (
-	"fmt"
-	"math"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 )
 
 type ConfirmedObservationRow struct {
-	TxHash         string `ch:"tx_hash"`
-	FiberTimestamp int64  `ch:"fiber_timestamp"`
-	OtherTimestamp int64  `ch:"other_timestamp"`
-	Difference     int64  `ch:"difference"`
-	BenchmarkID    string `ch:"benchmark_id"`
-	From           string `ch:"from"`
-	To             string `ch:"to"`
-	CallDataSize   int64  `ch:"calldata_size"`
+	TxHash             string `ch:"tx_hash"`
+	FiberTimestamp     int64  `ch:"fiber_timestamp"`
+	OtherTimestamp     int64  `ch:"other_timestamp"`
+	FiberWireTimestamp int64  `ch:"fiber_wire_timestamp"`
+	OtherWireTimestamp int64  `ch:"other_wire_timestamp"`
+	// Difference between the decoded timestamps (other - Fiber), which include the decoding of both sources
+	Difference    int64  `ch:"difference"`
+	BenchmarkID   string `ch:"benchmark_id"`
+	From          string `ch:"from"`
+	To            string `ch:"to"`
+	CallDataSize  int64  `ch:"calldata_size"`
+	FiberEndpoint string `ch:"fiber_endpoint"`
+
+	// Inclusion of the transaction. Timestamps are in microseconds.
+	BlockNumber      uint64 `ch:"block_number"`
+	TxIndex          int64  `ch:"tx_index"`
+	SlotTimestamp    int64  `ch:"slot_timestamp"`
+	PayloadTimestamp int64  `ch:"payload_timestamp"`
+
+	// Number of times each source repeated the observation, and the wire timestamp of its latest observation
+	FiberDuplicates        int64 `ch:"fiber_duplicates"`
+	OtherDuplicates        int64 `ch:"other_duplicates"`
+	FiberLastWireTimestamp int64 `ch:"fiber_last_wire_timestamp"`
+	OtherLastWireTimestamp int64 `ch:"other_last_wire_timestamp"`
+	// The other source wasn't live when the row was recorded, so it couldn't have seen what only Fiber saw
+	OtherDown bool `ch:"other_down"`
 }
 
 type BlockObservationRow struct {
-	BlockHash       string `ch:"block_hash"`
-	FiberTimestamp  int64  `ch:"fiber_timestamp"`
-	OtherTimestamp  int64  `ch:"other_timestamp"`
+	BlockHash          string `ch:"block_hash"`
+	FiberTimestamp     int64  `ch:"fiber_timestamp"`
+	OtherTimestamp     int64  `ch:"other_timestamp"`
+	FiberWireTimestamp int64  `ch:"fiber_wire_timestamp"`
+	OtherWireTimestamp int64  `ch:"other_wire_timestamp"`
+	// Difference between the decoded timestamps (other - Fiber), which include the decoding of both sources
 	Difference      int64  `ch:"difference"`
 	BenchmarkID     string `ch:"benchmark_id"`
 	TransactionsLen int64  `ch:"transactions_len"`
+
+	// Number of times each source repeated the observation, and the wire timestamp of its latest observation
+	FiberDuplicates        int64 `ch:"fiber_duplicates"`
+	OtherDuplicates        int64 `ch:"other_duplicates"`
+	FiberLastWireTimestamp int64 `ch:"fiber_last_wire_timestamp"`
+	OtherLastWireTimestamp int64 `ch:"other_last_wire_timestamp"`
+	// The other source wasn't live when the row was recorded, so it couldn't have seen what only Fiber saw
+	OtherDown bool `ch:"other_down"`
 }
 
 type ObservationStatsRow struct {
 	StartTime   time.Time `ch:"start_time"`
 	EndTime     time.Time `ch:"end_time"`
 	FiberWon    float64   `ch:"fiber_won"`
+	OtherWon    float64   `ch:"other_won"`
+	Tied        float64   `ch:"tied"`
 	Min         float64   `ch:"min"`
 	Max         float64   `ch:"max"`
 	Mean        float64   `ch:"mean"`
@@ -59,23 +86,136 @@ type ObservationStatsRow struct {
 	P95         float64   `ch:"p95"`
 	P99         float64   `ch:"p99"`
 	BenchmarkID string    `ch:"benchmark_id"`
+
+	// Number of differences that were discarded as outliers
+	Outliers int64 `ch:"outliers"`
+	// Number of repeated observations per unique hash of each source
+	FiberDuplicateRate float64 `ch:"fiber_duplicate_rate"`
+	OtherDuplicateRate float64 `ch:"other_duplicate_rate"`
+
+	// Health of the benchmarker during the interval. If tainted, the results might be distorted.
+	Tainted            bool    `ch:"tainted"`
+	MaxBufferOccupancy float64 `ch:"max_buffer_occupancy"`
+	BlockingEvents     int64   `ch:"blocking_events"`
+	// In milliseconds
+	GCPauseMax      float64 `ch:"gc_pause_max"`
+	SchedLatencyP99 float64 `ch:"sched_latency_p99"`
+
+	// Median time in milliseconds from the first observation of each source until the execution payload
+	// that included the transaction arrived, and until the start of its slot. Only set for transactions.
+	FiberPayloadLead float64 `ch:"fiber_payload_lead"`
+	OtherPayloadLead float64 `ch:"other_payload_lead"`
+	FiberSlotLead    float64 `ch:"fiber_slot_lead"`
+	OtherSlotLead    float64 `ch:"other_slot_lead"`
+
+	// Unique observations per second of each source
+	FiberRate float64 `ch:"fiber_rate"`
+	OtherRate float64 `ch:"other_rate"`
+	// Share of the confirmed transactions that each source saw. Only set for transactions with cross-check.
+	FiberCoverage float64 `ch:"fiber_coverage"`
+	OtherCoverage float64 `ch:"other_coverage"`
+	// Sources whose streams were open for the whole interval. The comparison stats are only set if both were.
+	LiveSources []string `ch:"live_sources"`
+}
+
+// Statuses of a run
+const (
+	RunRunning     = "running"
+	RunCompleted   = "completed"
+	RunInterrupted = "interrupted"
+	RunFailed      = "failed"
+)
+
+// RunMetadata describes how a benchmark was run. It's recorded when the benchmark starts and again when it's
+// done, the latest record of a run replaces the earlier ones. Durations are in milliseconds.
+type RunMetadata struct {
+	BenchmarkID string `ch:"benchmark_id" json:"benchmark_id"`
+	// 'transactions' or 'blocks'
+	Type   string `ch:"type" json:"type"`
+	Status string `ch:"status" json:"status"`
+	// Error the run failed with
+	Error      string    `ch:"error" json:"error"`
+	StartTime  time.Time `ch:"start_time" json:"start_time"`
+	EndTime    time.Time `ch:"end_time" json:"end_time"`
+	RecordedAt time.Time `ch:"recorded_at" json:"recorded_at"`
+	// Number of completed intervals, and of those that were tainted by the benchmarker's health
+	Intervals        int64 `ch:"intervals" json:"intervals"`
+	TaintedIntervals int64 `ch:"tainted_intervals" json:"tainted_intervals"`
+
+	Host      string `ch:"host" json:"host"`
+	Region    string `ch:"region" json:"region"`
+	GoVersion string `ch:"go_version" json:"go_version"`
+	// Empty if the binary wasn't built from a git checkout, suffixed with '-dirty' if it had local changes
+	GitCommit string `ch:"git_commit" json:"git_commit"`
+
+	FiberEndpoints []string `ch:"fiber_endpoints" json:"fiber_endpoints"`
+	// Number of Fiber endpoints multiplexed into a single stream
+	FiberMultiplexSize int64 `ch:"fiber_multiplex_size" json:"fiber_multiplex_size"`
+	PerEndpoint        bool  `ch:"per_endpoint" json:"per_endpoint"`
+	// Source that Fiber was compared against. Empty in Fiber-only mode. Endpoints only keep the host of URLs,
+	// since the rest can contain API keys.
+	OtherSource     string   `ch:"other_source" json:"other_source"`
+	OtherSourceType string   `ch:"other_source_type" json:"other_source_type"`
+	OtherEndpoints  []string `ch:"other_endpoints" json:"other_endpoints"`
+	Sinks           []string `ch:"sinks" json:"sinks"`
+
+	Interval      float64 `ch:"interval" json:"interval"`
+	IntervalCount int64   `ch:"interval_count" json:"interval_count"`
+	Warmup        float64 `ch:"warmup" json:"warmup"`
+	CrossCheck    bool    `ch:"cross_check" json:"cross_check"`
+	TieThreshold  float64 `ch:"tie_threshold" json:"tie_threshold"`
+	// Outlier threshold, 0 if disabled
+	MaxAbsDiff float64 `ch:"max_abs_diff" json:"max_abs_diff"`
+
+	// Synchronization of the system clock as reported by the kernel (NTP or chrony), in microseconds. The
+	// errors are -1 if unknown.
+	ClockSynced   bool  `ch:"clock_synced" json:"clock_synced"`
+	ClockOffset   int64 `ch:"clock_offset" json:"clock_offset"`
+	ClockEstError int64 `ch:"clock_est_error" json:"clock_est_error"`
+	ClockMaxError int64 `ch:"clock_max_error" json:"clock_max_error"`
+}
+
+// Run is a completed transaction benchmark, as loaded back from a sink
+type Run struct {
+	BenchmarkID  string
+	Observations []*ConfirmedObservationRow
+	Stats        []*ObservationStatsRow
+	// Nil if the run was recorded without metadata
+	Metadata *RunMetadata
+}
+
+// Inclusion describes where and when a confirmed transaction was included.
+type Inclusion struct {
+	BlockNumber uint64
+	// Position of the transaction in the block
+	TxIndex int
+	// Start of the slot in microseconds
+	SlotTimestamp int64
+	// Arrival of the execution payload in microseconds
+	PayloadTimestamp int64
 }
 
 type Observation struct {
 	// Hash
 	Hash common.Hash
-	// Timestamp in microseconds
-	Timestamp    int64
-	From         string
-	To           string
-	CallDataSize int64
+	// Timestamp in microseconds, taken after the message was decoded
+	Timestamp int64
+	// Timestamp in microseconds, taken as soon as the message was received
+	WireTimestamp int64
+	From          string
+	To            string
+	CallDataSize  int64
+	// Endpoint that delivered the observation, if known
+	Source string
 }
 
 type BlockObservation struct {
 	// Hash
 	Hash common.Hash
-	// Timestamp in microseconds
+	// Timestamp in microseconds, taken after the message was decoded
 	Timestamp int64
+	// Timestamp in microseconds, taken as soon as the message was received
+	WireTimestamp int64
 	// Number of transactions in the block
 	TransactionsLen int
 }
@@ -83,75 +223,3 @@ type BlockObservation struct {
 // Use a buffer here because we don't want to block transaction sources as this
 // would result in bad timestamps.
 const OBSERVATION_BUFFER_SIZE = 8192
-
-const (
-	numBins  = 22
-	binSize  = 1
-	minValue = -10
-	maxValue = 10
-)
-
-func MakeHistogram(data []float64) string {
-	if len(data) == 0 {
-		return ""
-	}
-	histogram := make([]int, numBins)
-
-	for _, value := range data {
-		binIndex := getBinIndex(value, minValue, maxValue)
-		if binIndex >= 0 && binIndex < numBins {
-			histogram[binIndex]++
-		}
-	}
-
-	result := ""
-	for i, count := range histogram {
-		percentage := float64(count) / float64(len(data)) * 100
-		binStart := getBinStart(i)
-		binEnd := getBinEnd(i)
-		bar := getHistogramBar(int(percentage))
-
-		result += fmt.Sprintf("%3s <-> %3s  %6.2f%%  %4s %s\n", binStart, binEnd, percentage, strconv.Itoa(count), bar)
-	}
-
-	return result
-}
-
-func getHistogramBar(count int) string {
-	barLength := count / 2
-	bar := strings.Repeat("█", barLength)
-	remainder := count % 2
-	if remainder > 0 {
-		bar += "▏"
-	}
-	return bar
-}
-
-func getBinIndex(value, minValue, maxValue float64) int {
-	if value < minValue {
-		return 0
-	}
-	if value > maxValue {
-		return numBins - 1
-	}
-
-	return int(math.Ceil(value+maxValue) / binSize)
-}
-
-func getBinStart(binIndex int) string {
-	if binIndex == 0 {
-		return "-∞"
-	}
-	return fmt.Sprintf("%d", -10+(binIndex-1)*binSize)
-}
-
-func getBinEnd(binIndex int) string {
-	if binIndex == 0 {
-		return fmt.Sprintf("%d", -10)
-	}
-	if binIndex == numBins-1 {
-		return "+∞"
-	}
-
-	return fmt.Sprintf("%d", -10+binIndex*binSize)
-}
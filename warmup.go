@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// warmUp consumes and discards observations until the warm-up period is over, so that results aren't
+// distorted by connections that are still warming up or by a stale backlog in the buffers.
+type warmUp struct {
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu sync.Mutex
+	// Number of discarded observations per stream
+	discarded map[string]int
+}
+
+// newWarmUp starts a warm-up period that ends after the duration, or once the context is canceled.
+func newWarmUp(ctx context.Context, duration time.Duration) *warmUp {
+	w := &warmUp{
+		done:      make(chan struct{}),
+		discarded: make(map[string]int),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-time.After(duration):
+		}
+		close(w.done)
+	}()
+
+	return w
+}
+
+// discard consumes the stream until the warm-up period is over.
+func discard[T any](w *warmUp, name string, ch chan T) {
+	w.wg.Add(1)
+
+	go func() {
+		defer w.wg.Done()
+
+		n := 0
+		defer func() {
+			w.mu.Lock()
+			w.discarded[name] += n
+			w.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+				n++
+			}
+		}
+	}()
+}
+
+// wait blocks until the warm-up period is over, and returns the number of discarded observations per stream.
+func (w *warmUp) wait() map[string]int {
+	w.wg.Wait()
+	return w.discarded
+}